@@ -1,50 +1,553 @@
 package pool
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"reflect"
+	"runtime/debug"
 	"sync"
 	"time"
 )
 
 // 配置連接池相關配置
 type Config struct {
-	// 連接池中擁有的最小連接數
+	// 連接池的名稱，用於在日誌及Stats中區分同一進程內的多個連接池
+	Name string
+	// 連接池中擁有的最小連接數，0表示啟動時不創建連接，首次Get時才通過factory創建
 	InitialCap int
 	// 連接池中擁有的最大的連接數
 	MaxCap int
 	// 生成連接的方法
 	Factory func() (interface{}, error)
+	// 生成連接並返回連接的標籤(例如所屬租戶)的方法，設置後優先於Factories和Factory
+	// 標籤可以通過Meta取得，無法作為map的key的連接不會保留標籤
+	FactoryWithMeta func() (interface{}, map[string]string, error)
+	// 支持context的生成連接的方法，設置後優先於Factory，GetContext的ctx會傳入其中
+	FactoryContext func(ctx context.Context) (interface{}, error)
+	// 多個生成連接的方法，例如分別連接不同的後端副本，設置後優先於Factory
+	// 每次創建時輪詢選擇，設置FactoryWeights時按權重隨機選擇
+	Factories []func() (interface{}, error)
+	// Factories對應的權重，為空表示輪詢
+	FactoryWeights []int
 	// 關閉連接的方法
 	Close func(interface{}) error
 	// 檢查連接是否有效的方法
 	Ping func(interface{}) error
+	// 支持context的檢查連接的方法，設置後優先於Ping，GetContext的ctx會傳入其中
+	PingContext func(ctx context.Context, conn interface{}) error
+	// 新創建的連接在放入連接池前調用，例如完成握手或認證，返回錯誤時關閉該連接並視為創建失敗
+	Prepare func(interface{}) error
+	// 自定義的連接可用性判斷，Get時在超時和Ping檢查之後調用，返回false則關閉該連接
+	Validate func(interface{}) bool
 	// 連接最大最大值時間，超過該事件則將無效
+	//
+	// Deprecated: 使用ConnMaxIdleTime，兩者都設置時以ConnMaxIdleTime為準
 	IdleTimeout time.Duration
+	// 連接自最近一次放回池中起的最長空閒時間，超過則將無效，0表示不限制，與database/sql的SetConnMaxIdleTime相同
+	ConnMaxIdleTime time.Duration
+	// 每條連接的空閒超時時間額外增加[0, IdleTimeoutJitter)內的隨機值，避免同時創建的連接同時被清理
+	IdleTimeoutJitter time.Duration
+	// 連接從創建起的最長存活時間，超過則將無效，0表示不限制
+	//
+	// Deprecated: 使用ConnMaxLifetime，兩者都設置時以ConnMaxLifetime為準
+	MaxConnLifetime time.Duration
+	// 連接從創建起的最長存活時間，超過則將無效，0表示不限制，與database/sql的SetConnMaxLifetime相同
+	ConnMaxLifetime time.Duration
+	// 輸出診斷信息的日誌，為空時不輸出
+	Logger Logger
+	// 定時通過Logger輸出統計信息的間隔，0表示不輸出
+	DebugDumpInterval time.Duration
+	// 連接數達到MaxCap時是否阻塞等待連接放回，否則返回ErrMaxActiveConnReached
+	Blocking bool
+	// 阻塞等待的最長時間，超過則返回ErrTimeout，0表示一直等待
+	WaitTimeout time.Duration
+	// 同時阻塞等待連接的調用方上限，達到後新的Get直接返回ErrTooManyWaiters，0表示不限制
+	MaxWaiters int
+	// Get默認的超時時間，包括等待及創建連接，超過則返回ErrTimeout，0表示不限制，不影響GetContext
+	GetTimeout time.Duration
+	// 放回連接時是否使用Ping檢查，無效的連接直接關閉
+	PingOnPut bool
+	// 連接放回或通過Ping檢查後在該時間內被取出時不再Ping，0表示每次Get都Ping
+	PingGracePeriod time.Duration
+	// 後台清理過期空閒連接的間隔，0表示只在Get時清理
+	ReapInterval time.Duration
+	// factory創建失敗時的重試次數，0表示不重試
+	FactoryRetries int
+	// 每次重試之間的等待時間
+	FactoryRetryDelay time.Duration
+	// 判斷factory的錯誤是否可重試，例如後端返回連接數過多，阻塞模式下返回true時Get改為等待連接放回
+	FactoryErrorIsRetriable func(error) bool
+	// 連接生命週期的回調，不會在持有鎖時調用，可以安全地重入連接池
+	OnCreate func(interface{})
+	OnClose  func(interface{})
+	OnGet    func(interface{})
+	OnPut    func(interface{})
+	// Release關閉空閒連接失敗時對每條連接調用，不會在持有鎖時調用
+	OnReleaseCloseError func(conn interface{}, err error)
+	// 空閒連接被取完及重新有空閒連接時各調用一次，只在狀態變化時調用，不會在持有鎖時調用
+	OnEmpty    func()
+	OnNotEmpty func()
+	// 連接數達到MaxCap的該比例(例如0.8)時調用一次OnHighWater，回落到該比例以下後重新生效，0表示不檢查
+	HighWaterMark float64
+	OnHighWater   func()
+	// 連接因超時、Ping失敗、池已滿等原因被連接池關閉時調用，傳入原因，在OnClose之後調用，不會在持有鎖時調用
+	OnEvict func(conn interface{}, reason EvictReason)
+	// 每次Get需要阻塞等待連接時調用，傳入等待的時間，不會在持有鎖時調用
+	OnWait func(waited time.Duration)
+	// 每次Get進入等待隊列時調用，傳入在隊列中的位置(從1開始，即包括自己在內的隊列長度)，不會在持有鎖時調用
+	// 等待者按進入隊列的先後順序獲得放回的連接，被喚醒後未取得連接時重新排到隊尾
+	OnEnqueue func(position int)
+	// 是否以LIFO順序復用空閒連接，默認為FIFO
+	// FIFO讓所有連接輪流被使用，每條連接都保持較少的活躍度；LIFO總是復用最近放回的連接，
+	// 低併發時多餘的連接會因空閒超時被清理，連接池自然收縮，但需配合IdleTimeout使用
+	LIFO bool
+	// 保持的最少空閒連接數，低於該值時在後台創建連接補齊，不會超過MaxCap
+	MinIdle int
+	// 最多保留的空閒連接數，空閒連接已達該值時放回的連接會被關閉，0表示與MaxCap相同
+	MaxIdle int
+	// 同時調用factory創建連接的最大數量，超過時等待創建完成或連接放回，0表示不限制
+	MaxConcurrentFactory int
+	// Get及後台補齊時每秒最多創建的連接數，阻塞模式下等待，否則返回ErrCreateRateExceeded，0表示不限制
+	// 不限制初始連接及Reset重新創建的連接
+	MaxCreateRate float64
+	// 等待連接的調用方超過該數量且連接數未達MaxCap時，在後台提前創建連接，0表示不提前創建
+	GrowThreshold int
+	// 單次Get最多丟棄的Ping失敗連接數，達到後直接嘗試創建新連接，0表示默認值3，負數表示不限制
+	MaxPingFailures int
+	// 空閒連接都未通過Ping檢查且無法創建新連接時，Get是否返回最後一個未通過Ping的連接
+	// 此時同時返回包裝了Ping錯誤的ErrDegraded，連接仍需放回或關閉
+	AllowStale bool
+	// 每條連接最多被取出的次數，達到後關閉並換用新連接，0表示不限制
+	MaxUses int
+	// 自定義空閒連接是否丟棄的判斷，設置後取代IdleTimeout/MaxConnLifetime/MaxUses對空閒連接的判斷
+	// Get及後台清理時調用，可能在持有鎖時調用，不能重入連接池
+	EvictionPolicy EvictionPolicy
+	// 是否併發創建InitialCap個初始連接，併發數受MaxConcurrentFactory限制
+	ParallelFill bool
+	// 創建初始連接時允許失敗的次數，未超過時連接池以較少的連接啟動
+	FillTolerance int
+	// Release時是否保留空閒連接不關閉，只清空連接池的記錄，由調用方自行管理這些連接
+	ReleaseDoesNotClose bool
+	// Release/Evict時每條連接關閉的最長等待時間，超過後不再等待，返回ErrCloseTimeout並繼續關閉其餘連接，0表示一直等待
+	// 超時的close仍在後台運行直到返回
+	CloseTimeout time.Duration
+	// 是否使用Ping檢查新創建的初始連接，失敗的連接會被關閉並重新創建，最多重試FactoryRetries次
+	ValidateOnCreate bool
+	// 是否在創建初始連接後Ping每條連接，通過的連接少於InitialCap時釋放連接池並返回錯誤，沒有設置Ping時忽略
+	// 與ValidateOnCreate不同，失敗的連接不會被重新創建，NewChannelPool成功返回時所有初始連接都通過了Ping
+	StartupHealthCheck bool
+	// 連接被取出超過該時間仍未放回或關閉時通過Logger輸出，用於排查連接洩漏，0表示不檢測
+	// 無法作為map的key的連接不會被檢測
+	LeakDetectionThreshold time.Duration
+	// 檢測連接洩漏時是否記錄取出連接時的調用棧，每次取出都需要獲取調用棧，開銷較大
+	LeakDetectionStack bool
 }
 
+// defaultMaxPingFailures單次Get默認最多丟棄的Ping失敗連接數
+const defaultMaxPingFailures = 3
+
+// minLeakDetectionInterval檢測連接洩漏的最短間隔，避免閾值過小時間隔為0
+const minLeakDetectionInterval = time.Millisecond
+
+var (
+	// errConnIdleTimeout連接超過空閒時間
+	errConnIdleTimeout = errors.New("connection idle timeout")
+	// errConnMaxLifetime連接超過最長存活時間
+	errConnMaxLifetime = errors.New("connection reached max lifetime")
+	// errConnMaxUses連接使用次數已達上限
+	errConnMaxUses = errors.New("connection reached max uses")
+	// errConnEvicted連接被EvictionPolicy判斷為應丟棄
+	errConnEvicted = errors.New("connection evicted by policy")
+	// errConnInvalid連接未通過Validate判斷
+	errConnInvalid = errors.New("connection failed validation")
+)
+
 // channelPool存放連接信息
 type channelPool struct {
-	mu          sync.Mutex
-	conns       chan *idleConn
-	factory     func() (interface{}, error)
+	mu sync.Mutex
+	// 連接池的名稱
+	name string
+	// 空閒連接，按放回的先後順序排列
+	conns idleRing
+	// 等待連接放回的調用方，按先後順序排列
+	waiters     []chan *idleConn
+	lifo        bool
+	minIdle     int
+	maxIdle     int
+	factory     func(ctx context.Context) (interface{}, error)
 	close       func(interface{}) error
-	ping        func(interface{}) error
+	ping        func(context.Context, interface{}) error
+	validate    func(interface{}) bool
+	prepare     func(interface{}) error
 	idleTimeout time.Duration
+	maxLifetime time.Duration
+	maxCap      int
+	logger      Logger
+	blocking    bool
+	waitTimeout time.Duration
+	getTimeout  time.Duration
+	maxWaiters  int
+	pingOnPut   bool
+	// 跳過Ping檢查的寬限期
+	pingGracePeriod time.Duration
+	// 單次Get最多丟棄的Ping失敗連接數
+	maxPingFailures int
+	maxUses         int
+	// 是否在無法取得可用連接時返回未通過Ping的連接
+	allowStale bool
+	// 空閒超時的隨機抖動範圍
+	idleTimeoutJitter time.Duration
+	// 自定義的丟棄判斷，為空時使用idleTimeout/maxLifetime/maxUses
+	evictionPolicy EvictionPolicy
+	// factory重試配置
+	factoryRetries    int
+	factoryRetryDelay time.Duration
+	// 判斷factory的錯誤是否可以等待連接放回
+	factoryErrorIsRetriable func(error) bool
+	// 是否Ping檢查新創建的初始連接
+	validateOnCreate bool
+	// 同時創建連接的上限及當前正在創建的數量
+	maxConcurrentFactory int
+	creating             int
+	// 觸發後台提前創建連接的等待者數量
+	growThreshold int
+	// 限制創建連接的速率，為空表示不限制
+	createLimiter *createLimiter
+	// 生命週期回調
+	onCreate func(interface{})
+	onClose  func(interface{})
+	onGet    func(interface{})
+	onPut    func(interface{})
+	onWait   func(time.Duration)
+	onEvict  func(interface{}, EvictReason)
+	// 進入等待隊列的回調
+	onEnqueue func(int)
+	// 空閒連接在空與非空之間變化的回調，idleEmpty為最近一次通知的狀態
+	onEmpty    func()
+	onNotEmpty func()
+	idleEmpty  bool
+	// 連接數高水位的比例及回調，aboveHighWater為最近一次判斷的狀態
+	highWaterMark  float64
+	onHighWater    func()
+	aboveHighWater bool
+	// Release關閉連接失敗的回調
+	onReleaseCloseError func(interface{}, error)
+	// 當前已打開的連接數(空閒+使用中)
+	openConns int
+	// 連接池是否已經釋放
+	closed bool
+	// Release時是否保留連接不關閉
+	releaseDoesNotClose bool
+	// Release/Evict時每條連接關閉的最長等待時間
+	closeTimeout time.Duration
+	// 是否正在後台補齊空閒連接
+	filling bool
+	// 連接池釋放時關閉，用於停止後台goroutine
+	done chan struct{}
+	// 阻塞模式下批量取連接的調用方逐個進行
+	batch chan struct{}
+	// 是否正在Drain，所有使用中的連接放回後關閉drained
+	draining bool
+	drained  chan struct{}
+	// WaitReady的等待者，空閒連接數達到readyCount時關閉
+	readyWaiters []chan struct{}
+	// 累計統計
+	totalCreated int64
+	totalClosed  int64
+	waitCount    int64
+	waitDuration time.Duration
+	// 池所管理連接的包裝，以連接本身為key，使創建時間、使用次數等信息在Get/Put之間保留
+	// 無法作為key的連接不會被記錄，每次放回時視為新連接
+	tracked map[interface{}]*idleConn
+	// 初始連接數，Reset後重新創建
+	initialCap int
+	// 每次Reset加一，早於當前代的連接放回時直接關閉
+	generation int
+	// FactoryWithMeta返回的標籤，連接納入管理時移到對應的idleConn
+	newTags map[interface{}]map[string]string
+	// 判斷空閒超時及最長存活時間使用的時鐘，測試時可替換為假的時鐘
+	now func() time.Time
+	// 連接洩漏檢測的閾值及是否記錄調用棧
+	leakDetectionThreshold time.Duration
+	leakDetectionStack     bool
+	// 創建連接池時的配置，SetFactory/SetPing/SetClose會同步更新，用於Clone
+	config Config
 }
 
+// idleConn 連接池為每條連接保存的信息，MaxConnLifetime/MaxUses/IdleTimeout/Reset等都基於這些信息判斷
 type idleConn struct {
 	conn interface{}
-	t    time.Time
+	// 最近一次放回池中或通過Ping檢查的時間，用於判斷空閒超時
+	t time.Time
+	// 連接創建的時間，不會改變
+	createdAt time.Time
+	// 連接被取出的次數
+	uses int
+	// 額外增加的空閒時間，使同時創建的連接不會同時超時
+	jitter time.Duration
+	// 創建或納入管理時連接池的代數
+	generation int
+	// 包裝是否取自idleConnPool，連接被取出後回收
+	pooled bool
+	// 是否已被Evict選中，放回時直接關閉
+	evicted bool
+	// FactoryWithMeta返回的標籤
+	tags map[string]string
+	// 最近一次被取出的時間及調用棧，放回後清空，只在檢測連接洩漏時記錄
+	checkedOut time.Time
+	stack      []byte
+	// 是否已輸出過洩漏信息，每次取出只輸出一次
+	leakReported bool
+	// PutAffinity放回時指定的親和性key
+	affinity interface{}
+}
+
+// idleConnPool複用無法記錄的連接的包裝，這些連接每次放回都需要新的包裝
+var idleConnPool = sync.Pool{
+	New: func() interface{} { return new(idleConn) },
+}
+
+// meta連接對外公開的信息
+func (wrapConn *idleConn) meta() ConnMeta {
+	return ConnMeta{CreatedAt: wrapConn.createdAt, IdleSince: wrapConn.t, Uses: wrapConn.uses, Tags: wrapConn.tags}
+}
+
+// newIdleConn創建連接的包裝
+func (c *channelPool) newIdleConn(conn interface{}) *idleConn {
+	return c.initIdleConn(new(idleConn), conn)
+}
+
+// initIdleConn初始化連接的包裝
+func (c *channelPool) initIdleConn(wrapConn *idleConn, conn interface{}) *idleConn {
+	now := c.now()
+	*wrapConn = idleConn{conn: conn, t: now, createdAt: now, generation: c.generation}
+	if c.idleTimeoutJitter > 0 {
+		wrapConn.jitter = time.Duration(rand.Int63n(int64(c.idleTimeoutJitter)))
+	}
+	return wrapConn
+}
+
+// unwrap取出包裝中的連接，來自idleConnPool的包裝會被回收
+func unwrap(wrapConn *idleConn) interface{} {
+	conn := wrapConn.conn
+	if wrapConn.pooled {
+		*wrapConn = idleConn{}
+		idleConnPool.Put(wrapConn)
+	}
+	return conn
+}
+
+// track記錄新創建的連接，需持有mu
+func (c *channelPool) track(conn interface{}) *idleConn {
+	c.totalCreated++
+	wrapConn := c.newIdleConn(conn)
+	if hashable(conn) {
+		c.tracked[conn] = wrapConn
+		if tags, ok := c.newTags[conn]; ok {
+			wrapConn.tags = tags
+			delete(c.newTags, conn)
+		}
+	}
+	return wrapConn
+}
+
+// dropTags丟棄未納入管理就被關閉的連接的標籤，需持有mu
+func (c *channelPool) dropTags(conn interface{}) {
+	if len(c.newTags) > 0 && hashable(conn) {
+		delete(c.newTags, conn)
+	}
+}
+
+// wrap取得連接對應的包裝，需持有mu
+func (c *channelPool) wrap(conn interface{}) *idleConn {
+	if !hashable(conn) {
+		wrapConn := c.initIdleConn(idleConnPool.Get().(*idleConn), conn)
+		wrapConn.pooled = true
+		return wrapConn
+	}
+
+	if wrapConn, ok := c.tracked[conn]; ok {
+		wrapConn.t = c.now()
+		wrapConn.checkedOut, wrapConn.stack, wrapConn.leakReported = time.Time{}, nil, false
+		return wrapConn
+	}
+
+	// 不是由連接池創建的連接，放回後納入連接池管理
+	wrapConn := c.newIdleConn(conn)
+	c.tracked[conn] = wrapConn
+	c.openConns++
+	return wrapConn
+}
+
+// forget移除連接的記錄並更新計數，返回該連接是否由連接池管理，需持有mu
+// 重複關閉或關閉不屬於連接池的連接不會影響計數，無法記錄的連接計數最低為0
+func (c *channelPool) forget(conn interface{}) bool {
+	if hashable(conn) {
+		if _, ok := c.tracked[conn]; !ok {
+			return false
+		}
+		delete(c.tracked, conn)
+	}
+
+	c.dropOpen()
+	c.totalClosed++
+	c.checkDrained()
+	// 空出的名額交給最早的等待者創建新連接，避免已達上限時所有連接都失效而等待者永遠等不到連接放回
+	c.wakeOne()
+	c.startFill()
+	return true
+}
+
+// unlock釋放mu，並在鎖外調用狀態變化的回調：
+// 空閒連接在空與非空之間變化時調用OnEmpty或OnNotEmpty，連接數升至高水位時調用OnHighWater
+func (c *channelPool) unlock() {
+	idleEvent := c.idleTransition()
+	highWaterEvent := c.highWaterTransition()
+	c.mu.Unlock()
+
+	if idleEvent != nil {
+		idleEvent()
+	}
+	if highWaterEvent != nil {
+		highWaterEvent()
+	}
+}
+
+// idleTransition記錄空閒連接是否為空，狀態變化時返回對應的回調，需持有mu
+func (c *channelPool) idleTransition() func() {
+	empty := c.conns.len() == 0
+	if empty == c.idleEmpty {
+		return nil
+	}
+	c.idleEmpty = empty
+	if empty {
+		return c.onEmpty
+	}
+	return c.onNotEmpty
+}
+
+// highWaterTransition記錄連接數是否達到高水位，由低升高時返回OnHighWater，回落後重新生效，需持有mu
+func (c *channelPool) highWaterTransition() func() {
+	if c.highWaterMark <= 0 {
+		return nil
+	}
+	above := c.overHighWater()
+	if above == c.aboveHighWater {
+		return nil
+	}
+	c.aboveHighWater = above
+	if above {
+		return c.onHighWater
+	}
+	return nil
+}
+
+// overHighWater判斷連接數是否達到高水位，需持有mu
+func (c *channelPool) overHighWater() bool {
+	return float64(c.openConns) >= c.highWaterMark*float64(c.maxCap)
+}
+
+// dropOpen已打開的連接數減一，最低為0，需持有mu
+// 回落到高水位以下時直接在鎖內記錄，不需要回調，再次升至高水位時OnHighWater重新調用，釋放mu時不必經過unlock
+func (c *channelPool) dropOpen() {
+	if c.openConns > 0 {
+		c.openConns--
+	}
+	if c.aboveHighWater && !c.overHighWater() {
+		c.aboveHighWater = false
+	}
+}
+
+// closeConn調用close關閉連接，close發生panic時轉換為錯誤，不會中斷調用方後續的處理
+func (c *channelPool) closeConn(closeFun func(interface{}) error, conn interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("close panicked: %v", r)
+			c.logger.Printf("conn is not able to be closed: %s", err)
+		}
+	}()
+
+	return closeFun(conn)
+}
+
+// closeConnTimeout在後台調用close，超過closeTimeout時不再等待並返回ErrCloseTimeout，未設置closeTimeout時與closeConn相同
+func (c *channelPool) closeConnTimeout(closeFun func(interface{}) error, conn interface{}) error {
+	if c.closeTimeout <= 0 {
+		return c.closeConn(closeFun, conn)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.closeConn(closeFun, conn)
+	}()
+
+	timer := time.NewTimer(c.closeTimeout)
+	defer timer.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		c.logger.Printf("conn is not able to be closed in %s", c.closeTimeout)
+		return ErrCloseTimeout
+	}
+}
+
+// callHook調用生命週期回調，回調為空時忽略
+func callHook(hook func(interface{}), conn interface{}) {
+	if hook != nil {
+		hook(conn)
+	}
+}
+
+// hashable判斷連接能否作為map的key
+// 只有結構體及數組的接口字段可能保存不可比較的值，需要按值判斷，其餘類型只判斷類型，避免每次調用都分配內存
+func hashable(conn interface{}) bool {
+	t := reflect.TypeOf(conn)
+	if t == nil || !t.Comparable() {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Struct, reflect.Array:
+		return reflect.ValueOf(conn).Comparable()
+	}
+	return true
 }
 
 // NewChannelPool初始化連接
 func NewChannelPool(poolConfig *Config) (Pool, error) {
+	c, err := newChannelPool(poolConfig, time.Now)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newChannelPool使用指定的時鐘初始化連接池，便於測試超時相關的邏輯
+func newChannelPool(poolConfig *Config, now func() time.Time) (*channelPool, error) {
 	if poolConfig.InitialCap < 0 || poolConfig.MaxCap <= 0 || poolConfig.InitialCap > poolConfig.MaxCap {
 		return nil, errors.New("invalid capacity settings")
 	}
 
-	if poolConfig.Factory == nil {
+	if poolConfig.MinIdle < 0 || poolConfig.MinIdle > poolConfig.MaxCap {
+		return nil, errors.New("invalid min idle settings")
+	}
+
+	if poolConfig.MaxIdle < 0 || poolConfig.MaxIdle > 0 && poolConfig.MinIdle > poolConfig.MaxIdle {
+		return nil, errors.New("invalid max idle settings")
+	}
+
+	if poolConfig.HighWaterMark < 0 || poolConfig.HighWaterMark > 1 {
+		return nil, errors.New("invalid high water mark settings")
+	}
+
+	if poolConfig.MaxCreateRate < 0 {
+		return nil, errors.New("invalid create rate settings")
+	}
+
+	if poolConfig.Factory == nil && poolConfig.FactoryContext == nil && poolConfig.FactoryWithMeta == nil && len(poolConfig.Factories) == 0 {
 		return nil, errors.New("invalid factory func settings")
 	}
 
@@ -53,158 +556,1918 @@ func NewChannelPool(poolConfig *Config) (Pool, error) {
 	}
 
 	c := &channelPool{
-		conns:       make(chan *idleConn, poolConfig.MaxCap),
-		factory:     poolConfig.Factory,
+		name:        poolConfig.Name,
+		conns:       newIdleRing(poolConfig.MaxCap),
+		lifo:        poolConfig.LIFO,
+		minIdle:     poolConfig.MinIdle,
+		maxIdle:     poolConfig.MaxIdle,
+		factory:     poolConfig.FactoryContext,
 		close:       poolConfig.Close,
+		validate:    poolConfig.Validate,
+		prepare:     poolConfig.Prepare,
 		idleTimeout: poolConfig.IdleTimeout,
+		maxLifetime: poolConfig.MaxConnLifetime,
+		maxCap:      poolConfig.MaxCap,
+		tracked:     make(map[interface{}]*idleConn),
+		newTags:     make(map[interface{}]map[string]string),
+		logger:      poolConfig.Logger,
+		blocking:    poolConfig.Blocking,
+		waitTimeout: poolConfig.WaitTimeout,
+		getTimeout:  poolConfig.GetTimeout,
+		maxWaiters:  poolConfig.MaxWaiters,
+		pingOnPut:   poolConfig.PingOnPut,
+		done:        make(chan struct{}),
+		batch:       make(chan struct{}, 1),
+		initialCap:  poolConfig.InitialCap,
+		now:         now,
+
+		maxPingFailures: poolConfig.MaxPingFailures,
+		allowStale:      poolConfig.AllowStale,
+		pingGracePeriod: poolConfig.PingGracePeriod,
+		maxUses:         poolConfig.MaxUses,
+
+		idleTimeoutJitter: poolConfig.IdleTimeoutJitter,
+		evictionPolicy:    poolConfig.EvictionPolicy,
+
+		factoryRetries:    poolConfig.FactoryRetries,
+		factoryRetryDelay: poolConfig.FactoryRetryDelay,
+		validateOnCreate:  poolConfig.ValidateOnCreate,
+
+		factoryErrorIsRetriable: poolConfig.FactoryErrorIsRetriable,
+
+		releaseDoesNotClose: poolConfig.ReleaseDoesNotClose,
+		closeTimeout:        poolConfig.CloseTimeout,
+
+		maxConcurrentFactory: poolConfig.MaxConcurrentFactory,
+		growThreshold:        poolConfig.GrowThreshold,
+
+		onCreate: poolConfig.OnCreate,
+		onClose:  poolConfig.OnClose,
+		onGet:    poolConfig.OnGet,
+		onPut:    poolConfig.OnPut,
+		onWait:   poolConfig.OnWait,
+		onEvict:  poolConfig.OnEvict,
+
+		onEnqueue: poolConfig.OnEnqueue,
+
+		onEmpty:    poolConfig.OnEmpty,
+		onNotEmpty: poolConfig.OnNotEmpty,
+
+		highWaterMark: poolConfig.HighWaterMark,
+		onHighWater:   poolConfig.OnHighWater,
+
+		onReleaseCloseError: poolConfig.OnReleaseCloseError,
+
+		leakDetectionThreshold: poolConfig.LeakDetectionThreshold,
+		leakDetectionStack:     poolConfig.LeakDetectionStack,
+
+		config: *poolConfig,
+	}
+
+	if poolConfig.ConnMaxIdleTime > 0 {
+		c.idleTimeout = poolConfig.ConnMaxIdleTime
 	}
 
-	if poolConfig.Ping != nil {
-		c.ping = poolConfig.Ping
+	if poolConfig.ConnMaxLifetime > 0 {
+		c.maxLifetime = poolConfig.ConnMaxLifetime
 	}
 
-	for i := 0; i < poolConfig.InitialCap; i++ {
-		conn, err := c.factory()
+	if poolConfig.MaxCreateRate > 0 {
+		c.createLimiter = newCreateLimiter(poolConfig.MaxCreateRate)
+	}
+
+	if c.factory == nil && poolConfig.FactoryWithMeta != nil {
+		factory := poolConfig.FactoryWithMeta
+		c.factory = func(context.Context) (interface{}, error) {
+			conn, tags, err := factory()
+			if err == nil && conn != nil && len(tags) > 0 && hashable(conn) {
+				c.mu.Lock()
+				c.newTags[conn] = tags
+				c.mu.Unlock()
+			}
+			return conn, err
+		}
+	}
+
+	if c.factory == nil && len(poolConfig.Factories) > 0 {
+		factory, err := multiFactory(poolConfig.Factories, poolConfig.FactoryWeights)
 		if err != nil {
+			return nil, err
+		}
+		c.factory = factory
+	}
+
+	if c.factory == nil {
+		factory := poolConfig.Factory
+		c.factory = func(context.Context) (interface{}, error) {
+			return factory()
+		}
+	}
+
+	c.factory = c.wrapFactory(c.factory)
+
+	if c.logger == nil {
+		c.logger = nopLogger{}
+	} else if c.name != "" {
+		c.logger = namedLogger{name: c.name, logger: c.logger}
+	}
+
+	if c.maxPingFailures == 0 {
+		c.maxPingFailures = defaultMaxPingFailures
+	}
+
+	if poolConfig.PingContext != nil {
+		c.ping = poolConfig.PingContext
+	} else if poolConfig.Ping != nil {
+		c.ping = pingContext(poolConfig.Ping)
+	}
+
+	if err := c.fillInitial(poolConfig.InitialCap, poolConfig.ParallelFill, poolConfig.FillTolerance); err != nil {
+		return nil, err
+	}
+
+	if poolConfig.StartupHealthCheck {
+		if err := c.startupHealthCheck(poolConfig.InitialCap); err != nil {
 			c.Release()
-			return nil, fmt.Errorf("factory is not able to fill the pool: %s", err)
+			return nil, err
 		}
-		c.conns <- &idleConn{conn: conn, t: time.Now()}
 	}
 
-	return c, nil
-}
+	if poolConfig.ReapInterval > 0 && (c.idleTimeout > 0 || c.maxLifetime > 0 || c.evictionPolicy != nil) {
+		go c.reaper(poolConfig.ReapInterval)
+	}
+
+	if poolConfig.DebugDumpInterval > 0 {
+		go c.dumper(poolConfig.DebugDumpInterval)
+	}
+
+	if c.leakDetectionThreshold > 0 {
+		interval := c.leakDetectionThreshold / 2
+		if interval < minLeakDetectionInterval {
+			interval = minLeakDetectionInterval
+		}
+		go c.leakDetector(interval)
+	}
 
-// getConns獲取所有連接
-func (c *channelPool) getConns() chan *idleConn {
 	c.mu.Lock()
-	conns := c.conns
-	c.mu.Unlock()
+	c.idleEmpty = c.conns.len() == 0
+	c.startFill()
+	c.unlock()
 
-	return conns
+	return c, nil
 }
 
-// 獲取從池中取一個連接
-func (c *channelPool) Get() (interface{}, error) {
-	conns := c.getConns()
-	if conns == nil {
-		return nil, ErrClosed
+// pingContext將不支持context的Ping轉換為內部使用的形式
+func pingContext(ping func(interface{}) error) func(context.Context, interface{}) error {
+	return func(_ context.Context, conn interface{}) error {
+		return ping(conn)
 	}
+}
 
-	for {
-		select {
-		case wrapConn := <-conns:
-			if wrapConn == nil {
-				return nil, ErrClosed
-			}
-			// 判斷是否超時，超時則最大化
-			if timeout := c.idleTimeout; timeout > 0 {
-				if wrapConn.t.Add(timeout).Before(time.Now()) {
-					// 展開並關閉該連接
-					c.Close(wrapConn.conn)
-					continue
-				}
-			}
-			// 判斷是否存在錯誤，是否可以替換，如果用戶沒有設置ping方法，就不檢查
-			if c.ping != nil {
-				if err := c.Ping(wrapConn.conn); err != nil {
-					fmt.Println("conn is not able to be connected: ", err)
-					continue
-				}
-			}
+// wrapFactory包裝factory，返回nil連接或Prepare失敗時當作創建失敗
+// Prepare失敗的連接會被關閉，並與factory失敗一樣按FactoryRetries重試
+func (c *channelPool) wrapFactory(factory func(context.Context) (interface{}, error)) func(context.Context) (interface{}, error) {
+	return func(ctx context.Context) (interface{}, error) {
+		conn, err := factory(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if conn == nil {
+			return nil, ErrNilConnection
+		}
+		if c.prepare == nil {
+			return conn, nil
+		}
 
-			return wrapConn.conn, nil
-		default:
+		if err := c.prepare(conn); err != nil {
 			c.mu.Lock()
-			if c.factory == nil {
-				c.mu.Unlock()
-				continue
-			}
+			c.dropTags(conn)
+			closeFun := c.close
+			c.mu.Unlock()
+			_ = c.closeConn(closeFun, conn)
+			return nil, err
+		}
+		return conn, nil
+	}
+}
 
-			conn, err := c.factory()
+// fillInitial創建初始連接，失敗次數超過tolerance時釋放連接池並返回錯誤
+func (c *channelPool) fillInitial(n int, parallel bool, tolerance int) error {
+	var (
+		failures int
+		lastErr  error
+	)
+	// add記錄一次創建的結果，返回是否繼續創建
+	add := func(conn interface{}, err error) bool {
+		c.mu.Lock()
+		if err != nil {
+			failures++
+			lastErr = err
+			ok := failures <= tolerance
 			c.mu.Unlock()
+			return ok
+		}
+		c.openConns++
+		c.conns.pushBack(c.track(conn))
+		c.mu.Unlock()
 
-			if err != nil {
-				return nil, err
-			}
+		callHook(c.onCreate, conn)
+		return true
+	}
 
-			return conn, nil
+	if parallel {
+		limit := n
+		if c.maxConcurrentFactory > 0 && c.maxConcurrentFactory < limit {
+			limit = c.maxConcurrentFactory
+		}
+		sem := make(chan struct{}, limit)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			sem <- struct{}{}
+			// 失敗次數已超過tolerance時不再創建，已創建的連接都已放入c.conns，由Release關閉
+			c.mu.Lock()
+			failed := failures > tolerance
+			c.mu.Unlock()
+			if failed {
+				<-sem
+				break
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				add(c.createInitial())
+				<-sem
+			}()
+		}
+		// 等待所有創建完成後再判斷，避免Release之後仍有連接被放入連接池
+		wg.Wait()
+	} else {
+		for i := 0; i < n; i++ {
+			if !add(c.createInitial()) {
+				break
+			}
 		}
 	}
-}
 
-// 將將連接放回pool中
-func (c *channelPool) Put(conn interface{}) error {
-	if conn == nil {
-		return errors.New("connection is nil. rejecting")
+	if failures > tolerance {
+		c.Release()
+		return fmt.Errorf("factory is not able to fill the pool: %w", lastErr)
 	}
+	if failures > 0 {
+		c.logger.Printf("%d of %d initial connections failed: %s", failures, n, lastErr)
+	}
+
+	return nil
+}
 
+// startupHealthCheck Ping每條初始連接，通過的連接少於n時返回錯誤
+func (c *channelPool) startupHealthCheck(n int) error {
 	c.mu.Lock()
+	idle := c.conns.slice()
+	ping := c.ping
+	c.mu.Unlock()
 
-	if c.conns == nil {
-		c.mu.Unlock()
-		return c.Close(conn)
+	if ping == nil {
+		return nil
 	}
 
-	select {
-	case c.conns <- &idleConn{conn: conn, t: time.Now()}:
-		c.mu.Unlock()
+	passed := 0
+	var lastErr error
+	for _, wrapConn := range idle {
+		if err := ping(context.Background(), wrapConn.conn); err != nil {
+			c.logger.Printf("initial conn is not able to be connected: %s", err)
+			lastErr = err
+			continue
+		}
+		passed++
+	}
+	if passed >= n {
 		return nil
-	default:
-		c.mu.Unlock()
-		// 連接池已滿，直接關閉該連接
-		return c.Close(conn)
 	}
+	if lastErr == nil {
+		return fmt.Errorf("startup health check: only %d of %d initial connections created", passed, n)
+	}
+	return fmt.Errorf("startup health check: %d of %d initial connections passed ping: %w", passed, n, &PingError{Err: lastErr})
 }
 
-// 關閉關閉單條連接
-func (c *channelPool) Close(conn interface{}) error {
-	if conn == nil {
-		return errors.New("connection is nil. rejecting")
+// createInitial創建一個初始連接，設置validateOnCreate時Ping檢查失敗的連接會被關閉並重新創建
+// factory或Prepare失敗與Ping失敗一樣按FactoryRetries重試，每次重試前等待FactoryRetryDelay
+func (c *channelPool) createInitial() (interface{}, error) {
+	var err error
+	for i := 0; i <= c.factoryRetries; i++ {
+		if i > 0 && c.factoryRetryDelay > 0 {
+			time.Sleep(c.factoryRetryDelay)
+		}
+		conn, factoryErr := c.factory(context.Background())
+		if factoryErr != nil {
+			err = &FactoryError{Err: factoryErr}
+			continue
+		}
+		if !c.validateOnCreate || c.ping == nil {
+			return conn, nil
+		}
+
+		pingErr := c.ping(context.Background(), conn)
+		if pingErr == nil {
+			return conn, nil
+		}
+		c.logger.Printf("new conn is not able to be connected: %s", pingErr)
+		c.mu.Lock()
+		c.dropTags(conn)
+		c.mu.Unlock()
+		_ = c.closeConn(c.close, conn)
+		err = &PingError{Err: pingErr}
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	return nil, err
+}
 
-	if c.close == nil {
-		return nil
+// popIdle按FIFO或LIFO順序取出一個空閒連接，沒有時返回nil，需持有mu
+func (c *channelPool) popIdle() *idleConn {
+	if c.lifo {
+		return c.conns.popBack()
+	}
+	return c.conns.popFront()
+}
+
+// pushIdle將連接交給等待中的調用方，沒有等待者時放入空閒連接，需持有mu
+// 空閒連接已達MaxIdle或MaxCap時返回false
+func (c *channelPool) pushIdle(wrapConn *idleConn) bool {
+	if len(c.waiters) > 0 {
+		req := c.waiters[0]
+		c.waiters[0] = nil
+		c.waiters = c.waiters[1:]
+		req <- wrapConn
+		return true
 	}
 
-	return c.close(conn)
+	if c.conns.len() >= c.idleCap() {
+		return false
+	}
+	c.conns.pushBack(wrapConn)
+	c.checkReady()
+	return true
 }
 
-// Ping檢查單條連接是否有效
-func (c *channelPool) Ping(conn interface{}) error {
-	if conn == nil {
-		return errors.New("connection is nil. rejecting")
+// readyCount WaitReady需要等到的空閒連接數，為MinIdle，未設置時為InitialCap，不超過最多保留的空閒連接數，需持有mu
+func (c *channelPool) readyCount() int {
+	n := c.minIdle
+	if n == 0 {
+		n = c.initialCap
+	}
+	if idleCap := c.idleCap(); n > idleCap {
+		n = idleCap
 	}
+	return n
+}
 
-	return c.ping(conn)
+// checkReady空閒連接數已達readyCount時喚醒所有WaitReady的等待者，需持有mu
+func (c *channelPool) checkReady() {
+	if len(c.readyWaiters) == 0 || c.conns.len() < c.readyCount() {
+		return
+	}
+	for _, ready := range c.readyWaiters {
+		close(ready)
+	}
+	c.readyWaiters = nil
 }
 
-// 發布釋放連接池中所有連接
-func (c *channelPool) Release() {
-	c.mu.Lock()
-	conns := c.conns
-	c.conns = nil
-	c.factory = nil
-	c.ping = nil
-	closeFun := c.close
-	c.close = nil
-	c.mu.Unlock()
+// idleCap最多保留的空閒連接數，需持有mu
+func (c *channelPool) idleCap() int {
+	if c.maxIdle > 0 && c.maxIdle < c.maxCap {
+		return c.maxIdle
+	}
+	return c.maxCap
+}
 
-	if conns == nil {
+// startFill空閒連接少於minIdle或等待者超過growThreshold時啟動後台補齊，需持有mu
+func (c *channelPool) startFill() {
+	if c.filling || !c.needFill() {
 		return
 	}
+	c.filling = true
+	go c.fill()
+}
+
+// needFill判斷是否需要補齊空閒連接，需持有mu
+func (c *channelPool) needFill() bool {
+	if c.closed || c.draining || c.openConns >= c.maxCap || c.factoryBusy() {
+		return false
+	}
+	return c.conns.len() < c.minIdle || c.growThreshold > 0 && len(c.waiters) > c.growThreshold
+}
 
-	close(conns)
+// factoryBusy判斷正在創建的連接數是否已達上限，需持有mu
+func (c *channelPool) factoryBusy() bool {
+	return c.maxConcurrentFactory > 0 && c.creating >= c.maxConcurrentFactory
+}
 
-	for wrapConn := range conns {
-		_ = closeFun(wrapConn.conn)
+// doneCreating一次創建結束，喚醒一個等待者重新嘗試，需持有mu
+func (c *channelPool) doneCreating() {
+	c.creating--
+	if c.maxConcurrentFactory > 0 {
+		c.wakeOne()
 	}
 }
 
-// Len連接池中已有的連接
-func (c *channelPool) Len() int {
-	return len(c.getConns())
+// fill在後台逐個創建連接，直到空閒連接達到minIdle且等待者不超過growThreshold，或連接數達到上限
+func (c *channelPool) fill() {
+	for {
+		c.mu.Lock()
+		if !c.needFill() {
+			c.filling = false
+			c.mu.Unlock()
+			return
+		}
+		c.openConns++
+		c.creating++
+		factory, closeFun := c.factory, c.close
+		c.unlock()
+
+		var conn interface{}
+		err := c.limitCreate(context.Background(), true)
+		if err == nil {
+			conn, err = c.create(context.Background(), factory)
+		}
+
+		c.mu.Lock()
+		c.doneCreating()
+		if err != nil {
+			c.dropOpen()
+			c.wakeOne()
+			c.filling = false
+			c.mu.Unlock()
+			c.logger.Printf("factory is not able to fill min idle: %s", err)
+			return
+		}
+		if c.closed {
+			c.filling = false
+			c.discardCreatedAfterRelease(conn, closeFun)
+			return
+		}
+		if !c.pushIdle(c.track(conn)) {
+			c.forget(conn)
+			c.filling = false
+			c.mu.Unlock()
+			_ = c.closeConn(closeFun, conn)
+			callHook(c.onClose, conn)
+			return
+		}
+		c.unlock()
+		callHook(c.onCreate, conn)
+	}
+}
+
+// removeWaiter從等待隊列中移除req，req已被喚醒時返回false，需持有mu
+func (c *channelPool) removeWaiter(req chan *idleConn) bool {
+	for i, waiter := range c.waiters {
+		if waiter == req {
+			copy(c.waiters[i:], c.waiters[i+1:])
+			c.waiters[len(c.waiters)-1] = nil
+			c.waiters = c.waiters[:len(c.waiters)-1]
+			return true
+		}
+	}
+	return false
+}
+
+// wakeOne喚醒最早的一個等待者，讓其重新嘗試獲取或創建連接，需持有mu
+func (c *channelPool) wakeOne() {
+	if len(c.waiters) == 0 {
+		return
+	}
+	req := c.waiters[0]
+	c.waiters[0] = nil
+	c.waiters = c.waiters[1:]
+	close(req)
+}
+
+// wakeWaiters喚醒所有等待中的調用方，讓其重新判斷連接池狀態，需持有mu
+func (c *channelPool) wakeWaiters() {
+	for _, req := range c.waiters {
+		close(req)
+	}
+	c.waiters = nil
+}
+
+// 獲取從池中取一個連接，設置GetTimeout時最多等待GetTimeout
+func (c *channelPool) Get() (interface{}, error) {
+	if c.getTimeout > 0 {
+		return c.GetWithTimeout(c.getTimeout)
+	}
+	return c.GetContext(context.Background())
+}
+
+// GetContext從池中取一個連接，ctx取消或超時則返回ctx.Err()
+// 等待期間ctx取消時已交付的連接會放回池中，創建期間ctx取消時新連接也會放回池中，不會洩漏連接
+func (c *channelPool) GetContext(ctx context.Context) (interface{}, error) {
+	conn, err := c.get(ctx)
+	if conn == nil {
+		return nil, err
+	}
+
+	callHook(c.onGet, conn)
+	return conn, err
+}
+
+// GetWithTimeout從池中取一個連接，最多等待d，超時則返回ErrTimeout
+func (c *channelPool) GetWithTimeout(d time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	conn, err := c.GetContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrTimeout
+	}
+	return conn, err
+}
+
+// get從空閒連接中取或者新建一個連接
+// 連接池狀態、空閒連接及factory都在同一次加鎖內讀取，鎖外創建連接後再加鎖重新判斷closed，
+// 與Release併發時不會使用已被置空的factory，也不會把新連接留在已釋放的連接池中
+// 設置AllowStale時可能同時返回連接及ErrDegraded
+func (c *channelPool) get(ctx context.Context) (interface{}, error) {
+	pingFailures := 0
+	// factory返回可重試的錯誤後，改為等待其他調用方放回連接
+	factoryRejected := false
+	// 設置AllowStale時保留最後一個未通過Ping的連接，沒有被返回時關閉
+	var (
+		stale    *idleConn
+		staleErr error
+	)
+	defer func() {
+		if stale != nil {
+			c.evict(unwrap(stale), EvictPingFailed)
+		}
+	}()
+	// keep保留未通過Ping的連接，關閉之前保留的連接
+	keep := func(wrapConn *idleConn, err error) {
+		if stale != nil {
+			c.evict(unwrap(stale), EvictPingFailed)
+		}
+		stale, staleErr = wrapConn, err
+	}
+	// degraded返回保留的連接及ErrDegraded
+	degraded := func() (interface{}, error) {
+		wrapConn := stale
+		stale = nil
+		c.mu.Lock()
+		wrapConn.uses++
+		c.mu.Unlock()
+		c.checkout(wrapConn)
+		return unwrap(wrapConn), fmt.Errorf("%w: %w", ErrDegraded, staleErr)
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// 每次循環都在鎖內判斷連接池狀態，Release後直接返回，不會空轉
+		c.mu.Lock()
+		if c.closed || c.draining {
+			c.mu.Unlock()
+			return nil, ErrClosed
+		}
+
+		// Ping失敗次數達到上限後不再消耗空閒連接，直接嘗試創建新連接
+		if c.maxPingFailures < 0 || pingFailures < c.maxPingFailures {
+			if wrapConn := c.popIdle(); wrapConn != nil {
+				c.startFill()
+				c.unlock()
+				if err := c.checkIdle(ctx, wrapConn, c.allowStale); err != nil {
+					if isPingError(err) {
+						pingFailures++
+						if c.allowStale {
+							keep(wrapConn, err)
+						}
+					}
+					continue
+				}
+
+				return unwrap(wrapConn), nil
+			}
+		}
+
+		// 已達上限，不再創建新連接
+		// 保留的連接在創建新連接期間不計入上限，創建成功後即被關閉
+		openConns := c.openConns
+		if stale != nil {
+			openConns--
+		}
+		atCap := openConns >= c.maxCap
+		// 有保留的連接時不再等待，無法創建新連接時直接返回該連接
+		if stale != nil && (atCap || c.factoryBusy() || factoryRejected) {
+			c.mu.Unlock()
+			return degraded()
+		}
+		if atCap && !c.blocking {
+			c.mu.Unlock()
+			return nil, ErrMaxActiveConnReached
+		}
+
+		if atCap || c.factoryBusy() || factoryRejected {
+			// 等待者過多時直接返回，避免在後端故障時無限制地堆積調用方
+			if c.maxWaiters > 0 && len(c.waiters) >= c.maxWaiters {
+				c.mu.Unlock()
+				return nil, ErrTooManyWaiters
+			}
+
+			// 阻塞等待其他調用方放回連接，或正在進行的創建完成
+			req := make(chan *idleConn, 1)
+			c.waiters = append(c.waiters, req)
+			position := len(c.waiters)
+			c.startFill()
+			c.mu.Unlock()
+
+			if c.onEnqueue != nil {
+				c.onEnqueue(position)
+			}
+
+			factoryRejected = false
+			wrapConn, err := c.wait(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+			if wrapConn == nil {
+				continue
+			}
+			if err := c.checkIdle(ctx, wrapConn, c.allowStale); err != nil {
+				if isPingError(err) {
+					pingFailures++
+					if c.allowStale {
+						keep(wrapConn, err)
+					}
+				}
+				continue
+			}
+
+			return unwrap(wrapConn), nil
+		}
+
+		// 先佔用名額，在鎖外創建連接，避免重試期間阻塞整個連接池
+		c.openConns++
+		c.creating++
+		factory, closeFun := c.factory, c.close
+		c.unlock()
+
+		var conn interface{}
+		err := c.limitCreate(ctx, c.blocking)
+		if err == nil {
+			conn, err = c.create(ctx, factory)
+		}
+
+		c.mu.Lock()
+		c.doneCreating()
+		if err != nil {
+			c.dropOpen()
+			if stale != nil {
+				c.mu.Unlock()
+				return degraded()
+			}
+			// 後端暫時拒絕創建連接時，阻塞模式下等待使用中的連接放回，沒有使用中的連接時直接返回錯誤
+			if c.blocking && c.openConns > 0 && c.factoryRetriable(err) {
+				c.mu.Unlock()
+				factoryRejected = true
+				continue
+			}
+			// 讓出佔用的名額，等待者重新嘗試創建
+			c.wakeOne()
+			c.mu.Unlock()
+			return nil, err
+		}
+		if c.closed {
+			c.discardCreatedAfterRelease(conn, closeFun)
+			return nil, ErrClosed
+		}
+		wrapConn := c.track(conn)
+		wrapConn.uses++
+		c.mu.Unlock()
+		c.checkout(wrapConn)
+		callHook(c.onCreate, conn)
+
+		// 創建期間ctx已取消，將連接放回池中避免洩漏
+		if err := ctx.Err(); err != nil {
+			c.Put(conn)
+			return nil, err
+		}
+
+		return conn, nil
+	}
+}
+
+// GetAffinity優先取回最近一次以相同key調用PutAffinity放回且仍空閒的連接，沒有或該連接已失效時與Get相同
+// key需要能夠比較，否則直接調用Get
+func (c *channelPool) GetAffinity(key interface{}) (interface{}, error) {
+	if key == nil || !hashable(key) {
+		return c.Get()
+	}
+
+	c.mu.Lock()
+	if c.closed || c.draining {
+		c.mu.Unlock()
+		return nil, ErrClosed
+	}
+	wrapConn := c.popAffinity(key)
+	c.startFill()
+	c.unlock()
+	if wrapConn == nil || c.checkIdle(context.Background(), wrapConn, false) != nil {
+		return c.Get()
+	}
+
+	conn := unwrap(wrapConn)
+	callHook(c.onGet, conn)
+	return conn, nil
+}
+
+// popAffinity取出最近放回的親和性key為key的空閒連接，沒有時返回nil，需持有mu
+func (c *channelPool) popAffinity(key interface{}) *idleConn {
+	for i := c.conns.len() - 1; i >= 0; i-- {
+		if c.conns.at(i).affinity == key {
+			return c.conns.removeAt(i)
+		}
+	}
+	return nil
+}
+
+// TryGet只從空閒連接中取一個可用連接，沒有時返回false，不會阻塞也不會創建新連接
+func (c *channelPool) TryGet() (interface{}, bool, error) {
+	for {
+		c.mu.Lock()
+		if c.closed || c.draining {
+			c.mu.Unlock()
+			return nil, false, ErrClosed
+		}
+
+		wrapConn := c.popIdle()
+		c.startFill()
+		c.unlock()
+		if wrapConn == nil {
+			return nil, false, nil
+		}
+		if c.checkIdle(context.Background(), wrapConn, false) != nil {
+			continue
+		}
+
+		conn := unwrap(wrapConn)
+		callHook(c.onGet, conn)
+		return conn, true, nil
+	}
+}
+
+// GetMany一次取出n個連接，任一個失敗時放回已取出的連接並返回錯誤
+// 遵循與Get相同的MaxCap及阻塞設置，n超過MaxCap時直接返回錯誤
+// 阻塞模式下多個GetMany逐個進行，即使未設置WaitTimeout也不會因各自取得部分連接而互相等待
+func (c *channelPool) GetMany(n int) ([]interface{}, error) {
+	if n <= 0 {
+		return nil, errors.New("invalid connection count")
+	}
+
+	c.mu.Lock()
+	maxCap := c.maxCap
+	c.mu.Unlock()
+	if n > maxCap {
+		return nil, ErrMaxActiveConnReached
+	}
+	if err := c.acquireBatch(context.Background()); err != nil {
+		return nil, err
+	}
+	defer c.releaseBatch()
+
+	conns := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := c.Get()
+		if err != nil {
+			// 未通過Ping的連接不放回池中
+			if conn != nil {
+				c.evict(conn, EvictPingFailed)
+			}
+			for _, conn := range conns {
+				c.Put(conn)
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	return conns, nil
+}
+
+// acquireBatch阻塞模式下等待其他批量調用方完成，避免多個調用方各取得部分連接後互相等待而永遠無法完成
+// 非阻塞模式下取不到連接時直接返回錯誤，不需要等待
+func (c *channelPool) acquireBatch(ctx context.Context) error {
+	if !c.blocking {
+		return nil
+	}
+	select {
+	case c.batch <- struct{}{}:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseBatch結束本次批量取連接
+func (c *channelPool) releaseBatch() {
+	if c.blocking {
+		<-c.batch
+	}
+}
+
+// limitCreate按MaxCreateRate限制創建連接的速率，block為true時等待令牌，否則沒有令牌時返回ErrCreateRateExceeded
+func (c *channelPool) limitCreate(ctx context.Context, block bool) error {
+	if c.createLimiter == nil {
+		return nil
+	}
+	if block {
+		return c.createLimiter.wait(ctx, c.done)
+	}
+	if !c.createLimiter.allow() {
+		return ErrCreateRateExceeded
+	}
+	return nil
+}
+
+// GetNContext取出n個連接，ctx取消或超時等錯誤發生時停止，n超過MaxCap時直接返回錯誤
+// partial為true時返回已取出的連接及錯誤，這些連接由調用方負責放回；為false時放回已取出的連接，只返回錯誤
+// 阻塞模式下與GetMany相同，多個批量調用方逐個進行
+func (c *channelPool) GetNContext(ctx context.Context, n int, partial bool) ([]interface{}, error) {
+	if n <= 0 {
+		return nil, errors.New("invalid connection count")
+	}
+
+	c.mu.Lock()
+	maxCap := c.maxCap
+	c.mu.Unlock()
+	if n > maxCap {
+		return nil, ErrMaxActiveConnReached
+	}
+	if err := c.acquireBatch(ctx); err != nil {
+		return nil, err
+	}
+	defer c.releaseBatch()
+
+	conns := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := c.GetContext(ctx)
+		if err != nil {
+			// 未通過Ping的連接不放回池中
+			if conn != nil {
+				c.evict(conn, EvictPingFailed)
+			}
+			if partial {
+				return conns, err
+			}
+			for _, conn := range conns {
+				c.Put(conn)
+			}
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	return conns, nil
+}
+
+// create調用factory創建連接，失敗時按factoryRetries重試
+// ctx在重試前或等待重試期間結束時不再重試，返回ctx.Err()
+func (c *channelPool) create(ctx context.Context, factory func(context.Context) (interface{}, error)) (interface{}, error) {
+	conn, err := factory(ctx)
+	for i := 0; err != nil && i < c.factoryRetries; i++ {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		if c.factoryRetryDelay > 0 {
+			timer := time.NewTimer(c.factoryRetryDelay)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			case <-timer.C:
+			}
+		}
+		conn, err = factory(ctx)
+	}
+	if err != nil {
+		return nil, &FactoryError{Err: err}
+	}
+
+	return conn, nil
+}
+
+// discardCreatedAfterRelease關閉創建期間連接池已釋放的連接，調用時須持有c.mu，返回前解鎖
+// 連接尚未被記錄，無法通過forget移除，直接更新計數
+func (c *channelPool) discardCreatedAfterRelease(conn interface{}, closeFun func(interface{}) error) {
+	c.dropOpen()
+	c.totalCreated++
+	c.totalClosed++
+	c.dropTags(conn)
+	c.mu.Unlock()
+	_ = c.closeConn(closeFun, conn)
+	callHook(c.onClose, conn)
+}
+
+// checkIdle判斷空閒連接是否仍可用，不可用的連接會被關閉並返回原因
+// keepStale為true時未通過Ping的連接不會被關閉，由調用方處理
+func (c *channelPool) checkIdle(ctx context.Context, wrapConn *idleConn, keepStale bool) error {
+	// 判斷是否超時、超過最長存活時間或使用次數已達上限，是則關閉
+	now := c.now()
+	if err := c.evictReason(wrapConn, now); err != nil {
+		c.evict(wrapConn.conn, evictReasonOf(err))
+		return err
+	}
+	// 判斷是否存在錯誤，是否可以替換，如果用戶沒有設置ping方法，就不檢查
+	// ping在鎖內讀取，Release會將其置空
+	c.mu.Lock()
+	ping := c.ping
+	c.mu.Unlock()
+	// 剛放回或剛通過檢查的連接在寬限期內不再Ping
+	if c.pingGracePeriod > 0 && now.Sub(wrapConn.t) < c.pingGracePeriod {
+		ping = nil
+	}
+	if ping != nil {
+		if err := ping(ctx, wrapConn.conn); err != nil {
+			// ctx在Ping期間取消或超時，不能說明連接無效，放回池中且不計入Ping失敗
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				c.repool(wrapConn)
+				return ctxErr
+			}
+			c.logger.Printf("conn is not able to be connected: %s", err)
+			if !keepStale {
+				c.evict(wrapConn.conn, EvictPingFailed)
+			}
+			return &PingError{Err: err}
+		}
+	}
+	// 用戶自定義的判斷，例如對端已要求斷開或認證已過期
+	if c.validate != nil && !c.validate(wrapConn.conn) {
+		c.evict(wrapConn.conn, EvictValidateFailed)
+		return errConnInvalid
+	}
+
+	// 連接仍被tracked記錄，Meta會在鎖內讀取，需在鎖內更新
+	c.mu.Lock()
+	if ping != nil {
+		// 剛通過檢查的連接重新計算空閒時間
+		wrapConn.t = c.now()
+	}
+	wrapConn.uses++
+	c.mu.Unlock()
+	c.checkout(wrapConn)
+	return nil
+}
+
+// checkout記錄連接被取出的時間及調用棧，用於檢測連接洩漏
+func (c *channelPool) checkout(wrapConn *idleConn) {
+	if c.leakDetectionThreshold <= 0 || !hashable(wrapConn.conn) {
+		return
+	}
+	// 在鎖外獲取調用棧，避免阻塞其他調用方
+	var stack []byte
+	if c.leakDetectionStack {
+		stack = debug.Stack()
+	}
+
+	c.mu.Lock()
+	wrapConn.checkedOut = c.now()
+	wrapConn.stack = stack
+	wrapConn.leakReported = false
+	c.mu.Unlock()
+}
+
+// factoryRetriable判斷factory返回的錯誤是否可以通過等待連接放回來解決
+func (c *channelPool) factoryRetriable(err error) bool {
+	var factoryErr *FactoryError
+	if c.factoryErrorIsRetriable == nil || !errors.As(err, &factoryErr) {
+		return false
+	}
+	return c.factoryErrorIsRetriable(factoryErr.Err)
+}
+
+// isPingError判斷錯誤是否由Ping檢查失敗引起
+func isPingError(err error) bool {
+	var pingErr *PingError
+	return errors.As(err, &pingErr)
+}
+
+// reaper定時清理過期的空閒連接，連接池釋放時退出
+func (c *channelPool) reaper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.reap()
+		}
+	}
+}
+
+// evictReason判斷空閒連接是否應被丟棄並返回原因，設置EvictionPolicy時由其判斷
+func (c *channelPool) evictReason(wrapConn *idleConn, now time.Time) error {
+	if c.evictionPolicy != nil {
+		if c.evictionPolicy.ShouldEvict(wrapConn.conn, wrapConn.meta()) {
+			return errConnEvicted
+		}
+		return nil
+	}
+
+	if timeout := c.idleTimeout; timeout > 0 && wrapConn.t.Add(timeout+wrapConn.jitter).Before(now) {
+		return errConnIdleTimeout
+	}
+	if lifetime := c.maxLifetime; lifetime > 0 && wrapConn.createdAt.Add(lifetime).Before(now) {
+		return errConnMaxLifetime
+	}
+	if c.maxUses > 0 && wrapConn.uses >= c.maxUses {
+		return errConnMaxUses
+	}
+	return nil
+}
+
+// evictReasonOf將evictReason返回的錯誤轉換為EvictReason
+func evictReasonOf(err error) EvictReason {
+	switch {
+	case errors.Is(err, errConnIdleTimeout):
+		return EvictIdleTimeout
+	case errors.Is(err, errConnMaxLifetime):
+		return EvictMaxLifetime
+	case errors.Is(err, errConnMaxUses):
+		return EvictMaxUses
+	default:
+		return EvictPolicy
+	}
+}
+
+// evict關閉被連接池丟棄的連接並調用OnEvict
+func (c *channelPool) evict(conn interface{}, reason EvictReason) error {
+	err := c.Close(conn)
+	if c.onEvict != nil {
+		c.onEvict(conn, reason)
+	}
+	return err
+}
+
+// reap在鎖內移除過期的空閒連接，保持其餘連接的順序，再在鎖外關閉過期的連接
+func (c *channelPool) reap() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+
+	now := c.now()
+	var reasons []EvictReason
+	expired := c.conns.filter(func(wrapConn *idleConn) bool {
+		if err := c.evictReason(wrapConn, now); err != nil {
+			reasons = append(reasons, evictReasonOf(err))
+			return false
+		}
+		return true
+	})
+	for _, wrapConn := range expired {
+		c.forget(wrapConn.conn)
+	}
+	closeFun := c.close
+	c.unlock()
+
+	for i, wrapConn := range expired {
+		_ = c.closeConn(closeFun, wrapConn.conn)
+		callHook(c.onClose, wrapConn.conn)
+		if c.onEvict != nil {
+			c.onEvict(wrapConn.conn, reasons[i])
+		}
+	}
+}
+
+// leakDetector定時檢查被取出超過閾值仍未放回的連接並通過Logger輸出，連接池釋放時退出
+func (c *channelPool) leakDetector(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.detectLeaks()
+		}
+	}
+}
+
+// detectLeaks輸出被取出超過閾值仍未放回的連接，每次取出只輸出一次
+func (c *channelPool) detectLeaks() {
+	c.mu.Lock()
+	now := c.now()
+	var leaks []string
+	for _, wrapConn := range c.tracked {
+		if wrapConn.checkedOut.IsZero() || wrapConn.leakReported || now.Sub(wrapConn.checkedOut) < c.leakDetectionThreshold {
+			continue
+		}
+		wrapConn.leakReported = true
+		leak := fmt.Sprintf("connection leak detected: %v checked out %s ago", wrapConn.conn, now.Sub(wrapConn.checkedOut))
+		if len(wrapConn.stack) > 0 {
+			leak += "\n" + string(wrapConn.stack)
+		}
+		leaks = append(leaks, leak)
+	}
+	c.mu.Unlock()
+
+	for _, leak := range leaks {
+		c.logger.Printf("%s", leak)
+	}
+}
+
+// dumper定時輸出統計信息，連接池釋放時退出
+func (c *channelPool) dumper(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.logger.Printf("pool stats: %s", c.Stats())
+		}
+	}
+}
+
+// wait等待其他調用方放回連接，最多等待waitTimeout
+// 連接池釋放或狀態變化時返回nil，由調用方重新判斷連接池狀態
+func (c *channelPool) wait(ctx context.Context, req chan *idleConn) (*idleConn, error) {
+	start := time.Now()
+	defer func() {
+		waited := time.Since(start)
+		c.mu.Lock()
+		c.waitCount++
+		c.waitDuration += waited
+		c.mu.Unlock()
+
+		if c.onWait != nil {
+			c.onWait(waited)
+		}
+	}()
+
+	var timeout <-chan time.Time
+	if c.waitTimeout > 0 {
+		timer := time.NewTimer(c.waitTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case wrapConn := <-req:
+		return wrapConn, nil
+	case <-timeout:
+		c.cancelWait(req)
+		return nil, ErrTimeout
+	case <-ctx.Done():
+		c.cancelWait(req)
+		return nil, ctx.Err()
+	}
+}
+
+// cancelWait放棄等待，若放棄前已收到連接則將其放回池中，避免連接洩漏
+func (c *channelPool) cancelWait(req chan *idleConn) {
+	c.mu.Lock()
+	if c.removeWaiter(req) {
+		c.mu.Unlock()
+		return
+	}
+
+	wrapConn := <-req
+	c.mu.Unlock()
+	if wrapConn != nil {
+		c.repool(wrapConn)
+	}
+}
+
+// repool將已取出但未交給調用方的連接放回池中，連接池已釋放或已滿時關閉
+func (c *channelPool) repool(wrapConn *idleConn) {
+	c.mu.Lock()
+	if !c.closed && c.pushIdle(wrapConn) {
+		c.unlock()
+		return
+	}
+	c.mu.Unlock()
+
+	c.Close(wrapConn.conn)
+}
+
+// 將將連接放回pool中
+// Put不會阻塞：有等待者時直接交給等待者，否則放入空閒連接，連接池已滿時關閉該連接並返回ErrPoolFull
+// 連接池已經釋放時關閉該連接並返回ErrClosed
+// 在Reset之前創建、已被Evict選中或已超過MaxConnLifetime的連接會被關閉而不放回，返回ErrConnDiscarded；被取出的時間不算作空閒，與database/sql相同不按IdleTimeout判斷
+func (c *channelPool) Put(conn interface{}) error {
+	return c.put(conn, nil)
+}
+
+// PutAffinity將連接放回pool中並記錄親和性key，之後以相同key調用GetAffinity時優先取回該連接，其餘與Put相同
+func (c *channelPool) PutAffinity(conn interface{}, key interface{}) error {
+	return c.put(conn, key)
+}
+
+// put將連接放回pool中，key為連接的親和性key，nil表示沒有
+func (c *channelPool) put(conn interface{}, key interface{}) error {
+	if conn == nil {
+		return errors.New("connection is nil. rejecting")
+	}
+
+	callHook(c.onPut, conn)
+
+	if c.pingOnPut {
+		c.mu.Lock()
+		ping := c.ping
+		c.mu.Unlock()
+
+		// 連接已失效，不再放回池中
+		if ping != nil {
+			if err := ping(context.Background(), conn); err != nil {
+				c.logger.Printf("conn is not able to be connected: %s", err)
+				return errors.Join(&PingError{Err: err}, c.evict(conn, EvictPingFailed))
+			}
+		}
+	}
+
+	c.mu.Lock()
+
+	if c.closed {
+		// 設置ReleaseDoesNotClose時連接交由調用方管理，只移除記錄
+		if c.releaseDoesNotClose {
+			c.forget(conn)
+			c.mu.Unlock()
+			return ErrClosed
+		}
+		c.mu.Unlock()
+		if err := c.Close(conn); err != nil {
+			return fmt.Errorf("%w: %w", ErrClosed, err)
+		}
+		return ErrClosed
+	}
+
+	wrapConn := c.wrap(conn)
+	// 在Reset之前創建或已被Evict選中的連接直接關閉，不再放回池中
+	if wrapConn.evicted || wrapConn.generation != c.generation {
+		c.mu.Unlock()
+		return c.discard(conn, EvictManual)
+	}
+	// 已超過最長存活時間的連接直接關閉
+	if lifetime := c.maxLifetime; lifetime > 0 && wrapConn.createdAt.Add(lifetime).Before(wrapConn.t) {
+		c.mu.Unlock()
+		return c.discard(conn, EvictMaxLifetime)
+	}
+	wrapConn.affinity = key
+
+	if c.pushIdle(wrapConn) {
+		c.checkDrained()
+		c.unlock()
+		return nil
+	}
+	c.mu.Unlock()
+
+	// 連接池已滿，直接關閉該連接
+	if err := c.evict(conn, EvictPoolFull); err != nil {
+		return fmt.Errorf("%w: %w", ErrPoolFull, err)
+	}
+	return ErrPoolFull
+}
+
+// discard關閉不再放回池中的連接並返回ErrConnDiscarded，關閉失敗時一併返回關閉的錯誤
+func (c *channelPool) discard(conn interface{}, reason EvictReason) error {
+	if err := c.evict(conn, reason); err != nil {
+		return fmt.Errorf("%w: %w", ErrConnDiscarded, err)
+	}
+	return ErrConnDiscarded
+}
+
+// PutAll將多個連接放回pool中，某個連接失敗時仍會繼續放回其餘連接
+// 返回所有失敗(例如連接池已滿而被關閉)的錯誤合併後的錯誤
+func (c *channelPool) PutAll(conns []interface{}) error {
+	var errs []error
+	for _, conn := range conns {
+		if err := c.Put(conn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// 關閉關閉單條連接，應只用於由連接池取出的連接，重複關閉不會影響計數
+func (c *channelPool) Close(conn interface{}) error {
+	if conn == nil {
+		return errors.New("connection is nil. rejecting")
+	}
+
+	// 只在鎖內更新計數，在鎖外調用close，避免較慢的close阻塞其他調用方
+	c.mu.Lock()
+	c.forget(conn)
+	closeFun := c.close
+	c.mu.Unlock()
+
+	var err error
+	if closeFun != nil {
+		if closeErr := c.closeConn(closeFun, conn); closeErr != nil {
+			err = &CloseError{Conn: conn, Err: closeErr}
+		}
+	}
+
+	callHook(c.onClose, conn)
+	return err
+}
+
+// Ping檢查單條連接是否有效，沒有設置Ping或連接池已釋放時返回nil
+func (c *channelPool) Ping(conn interface{}) error {
+	if conn == nil {
+		return errors.New("connection is nil. rejecting")
+	}
+
+	c.mu.Lock()
+	ping := c.ping
+	c.mu.Unlock()
+
+	// 與Get一致，沒有設置ping方法時不檢查
+	if ping == nil {
+		return nil
+	}
+	return ping(context.Background(), conn)
+}
+
+// 發布釋放連接池中所有連接，返回所有關閉失敗的CloseError合併後的錯誤
+// 設置ReleaseDoesNotClose時只清空連接池的記錄，不關閉空閒連接
+// 可以被多個goroutine重複或同時調用，只有第一次調用會關閉連接，其餘調用直接返回nil
+func (c *channelPool) Release() error {
+	_, err := c.ReleaseCount()
+	return err
+}
+
+// ReleaseCount與Release相同，並返回成功關閉的空閒連接數，例如用於記錄關閉時釋放了多少連接
+func (c *channelPool) ReleaseCount() (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, nil
+	}
+	conns := c.conns.take()
+	c.factory = nil
+	c.ping = nil
+	// 保留close，Release之後放回或關閉的使用中連接仍需要關閉
+	closeFun := c.close
+	c.closed = true
+	close(c.done)
+	c.wakeWaiters()
+	c.mu.Unlock()
+
+	var (
+		closed int
+		errs   []error
+	)
+	for _, wrapConn := range conns {
+		c.mu.Lock()
+		c.forget(wrapConn.conn)
+		c.mu.Unlock()
+
+		if c.releaseDoesNotClose {
+			continue
+		}
+		if err := c.closeConnTimeout(closeFun, wrapConn.conn); err != nil {
+			errs = append(errs, &CloseError{Conn: wrapConn.conn, Err: err})
+			if c.onReleaseCloseError != nil {
+				c.onReleaseCloseError(wrapConn.conn, err)
+			}
+		} else {
+			closed++
+		}
+		callHook(c.onClose, wrapConn.conn)
+	}
+
+	return closed, errors.Join(errs...)
+}
+
+// Reset關閉所有空閒連接並使用當前的factory重新創建InitialCap個連接，連接池本身保持可用
+// 使用中的連接放回時會被直接關閉，適用於憑證輪換後需要重建所有連接的場景
+func (c *channelPool) Reset() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	c.generation++
+	idle := c.conns.take()
+	for _, wrapConn := range idle {
+		c.forget(wrapConn.conn)
+	}
+	closeFun := c.close
+	c.unlock()
+
+	var errs []error
+	for _, wrapConn := range idle {
+		if err := c.closeConn(closeFun, wrapConn.conn); err != nil {
+			errs = append(errs, &CloseError{Conn: wrapConn.conn, Err: err})
+		}
+		callHook(c.onClose, wrapConn.conn)
+		if c.onEvict != nil {
+			c.onEvict(wrapConn.conn, EvictManual)
+		}
+	}
+
+	if err := c.refill(c.initialCap); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// refill逐個創建連接直到空閒連接數達到n，連接數達到上限或創建失敗時停止
+func (c *channelPool) refill(n int) error {
+	for {
+		c.mu.Lock()
+		if c.closed || c.conns.len() >= n || c.openConns >= c.maxCap {
+			c.mu.Unlock()
+			return nil
+		}
+		c.openConns++
+		c.creating++
+		factory, closeFun := c.factory, c.close
+		c.unlock()
+
+		conn, err := c.create(context.Background(), factory)
+
+		c.mu.Lock()
+		c.doneCreating()
+		if err != nil {
+			c.dropOpen()
+			c.wakeOne()
+			c.mu.Unlock()
+			return err
+		}
+		if c.closed {
+			c.discardCreatedAfterRelease(conn, closeFun)
+			return nil
+		}
+		if !c.pushIdle(c.track(conn)) {
+			c.forget(conn)
+			c.mu.Unlock()
+			_ = c.closeConn(closeFun, conn)
+			callHook(c.onClose, conn)
+			return nil
+		}
+		c.unlock()
+		callHook(c.onCreate, conn)
+	}
+}
+
+// Evict關閉滿足pred的空閒連接並返回關閉的數量，滿足pred的使用中連接在放回時關閉
+// pred在鎖外調用，例如可用於故障切換後清理指向某個失效副本的連接
+// 關閉失敗的錯誤以CloseError記錄每條連接，合併後返回
+func (c *channelPool) Evict(pred func(interface{}) bool) (int, error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return 0, nil
+	}
+	// 在鎖內記錄連接及其創建時間，無法記錄的連接的包裝取出後會被復用，標記前需確認仍是同一條空閒連接
+	type candidate struct {
+		wrapConn  *idleConn
+		conn      interface{}
+		createdAt time.Time
+	}
+	candidates := make([]candidate, 0, len(c.tracked)+c.conns.len())
+	for conn, wrapConn := range c.tracked {
+		candidates = append(candidates, candidate{wrapConn, conn, wrapConn.createdAt})
+	}
+	for i := 0; i < c.conns.len(); i++ {
+		if wrapConn := c.conns.at(i); !hashable(wrapConn.conn) {
+			candidates = append(candidates, candidate{wrapConn, wrapConn.conn, wrapConn.createdAt})
+		}
+	}
+	c.mu.Unlock()
+
+	var matched []candidate
+	for _, cand := range candidates {
+		if pred(cand.conn) {
+			matched = append(matched, cand)
+		}
+	}
+	if len(matched) == 0 {
+		return 0, nil
+	}
+
+	c.mu.Lock()
+	idle := make(map[*idleConn]bool, c.conns.len())
+	for i := 0; i < c.conns.len(); i++ {
+		idle[c.conns.at(i)] = true
+	}
+	for _, cand := range matched {
+		if hashable(cand.conn) {
+			if c.tracked[cand.conn] == cand.wrapConn {
+				cand.wrapConn.evicted = true
+			}
+		} else if idle[cand.wrapConn] && cand.wrapConn.createdAt.Equal(cand.createdAt) {
+			cand.wrapConn.evicted = true
+		}
+	}
+	evicted := c.conns.filter(func(wrapConn *idleConn) bool {
+		return !wrapConn.evicted
+	})
+	for _, wrapConn := range evicted {
+		c.forget(wrapConn.conn)
+	}
+	closeFun := c.close
+	c.unlock()
+
+	var errs []error
+	for _, wrapConn := range evicted {
+		if err := c.closeConnTimeout(closeFun, wrapConn.conn); err != nil {
+			errs = append(errs, &CloseError{Conn: wrapConn.conn, Err: err})
+		}
+		callHook(c.onClose, wrapConn.conn)
+		if c.onEvict != nil {
+			c.onEvict(wrapConn.conn, EvictManual)
+		}
+	}
+
+	return len(evicted), errors.Join(errs...)
+}
+
+// SetFactory替換生成連接的方法，之後創建的連接使用新的factory
+// 已有的連接不受影響，需要立即重建所有連接時再調用Reset，傳入nil或連接池已釋放時忽略
+func (c *channelPool) SetFactory(factory func() (interface{}, error)) {
+	if factory == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.factory = c.wrapFactory(func(context.Context) (interface{}, error) {
+		return factory()
+	})
+	c.config.Factory = factory
+	c.config.FactoryWithMeta = nil
+	c.config.FactoryContext = nil
+	c.config.Factories = nil
+	c.config.FactoryWeights = nil
+}
+
+// SetPing替換檢查連接是否有效的方法，傳入nil表示不再檢查，連接池已釋放時忽略
+func (c *channelPool) SetPing(ping func(interface{}) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.config.Ping = ping
+	c.config.PingContext = nil
+	if ping == nil {
+		c.ping = nil
+		return
+	}
+	c.ping = pingContext(ping)
+}
+
+// SetClose替換關閉連接的方法，之後關閉的連接都使用新的方法，傳入nil或連接池已釋放時忽略
+func (c *channelPool) SetClose(closeFun func(interface{}) error) {
+	if closeFun == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	c.close = closeFun
+	c.config.Close = closeFun
+}
+
+// IsClosed連接池是否已經釋放
+func (c *channelPool) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.closed
+}
+
+// Len連接池擁有的連接總數(空閒+使用中)
+func (c *channelPool) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.openConns
+}
+
+// IdleLen連接池中空閒的連接數
+func (c *channelPool) IdleLen() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.conns.len()
+}
+
+// Available在達到MaxCap之前還能創建的連接數，連接池釋放後返回0
+func (c *channelPool) Available() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.openConns >= c.maxCap {
+		return 0
+	}
+	return c.maxCap - c.openConns
+}
+
+// OldestIdle最久未使用的空閒連接已空閒的時間，沒有空閒連接時返回false
+func (c *channelPool) OldestIdle() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conns.len() == 0 {
+		return 0, false
+	}
+	oldest := c.conns.at(0).t
+	for i := 1; i < c.conns.len(); i++ {
+		if t := c.conns.at(i).t; t.Before(oldest) {
+			oldest = t
+		}
+	}
+	return c.now().Sub(oldest), true
+}
+
+// Meta取得連接池記錄的連接信息，包括FactoryWithMeta返回的標籤，可在InspectIdle及生命週期回調中使用
+// 連接不屬於連接池或無法被記錄時返回false
+func (c *channelPool) Meta(conn interface{}) (ConnMeta, bool) {
+	if conn == nil || !hashable(conn) {
+		return ConnMeta{}, false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	wrapConn, ok := c.tracked[conn]
+	if !ok {
+		return ConnMeta{}, false
+	}
+	return wrapConn.meta(), true
+}
+
+// InspectIdle按空閒連接的順序對每條連接調用fn，用於診斷，例如輸出連接的遠端地址
+// 連接不會被取出，fn僅用於查看，不能保留或使用該連接；fn在鎖外調用，期間連接池的變化不會反映到本次遍歷
+func (c *channelPool) InspectIdle(fn func(conn interface{}, idleSince time.Time)) {
+	type idleInfo struct {
+		conn      interface{}
+		idleSince time.Time
+	}
+
+	c.mu.Lock()
+	idle := make([]idleInfo, c.conns.len())
+	for i := range idle {
+		wrapConn := c.conns.at(i)
+		idle[i] = idleInfo{wrapConn.conn, wrapConn.t}
+	}
+	c.mu.Unlock()
+
+	for _, info := range idle {
+		fn(info.conn, info.idleSince)
+	}
+}
+
+// Stats連接池統計信息，Release之後仍可調用，累計的創建及關閉數不會清零，可用於輸出最終的統計
+func (c *channelPool) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	idle := c.conns.len()
+	return Stats{
+		Name:         c.name,
+		IdleCount:    idle,
+		ActiveCount:  c.openConns - idle,
+		TotalCreated: c.totalCreated,
+		TotalClosed:  c.totalClosed,
+		WaitCount:    c.waitCount,
+		WaitDuration: c.waitDuration,
+	}
+}
+
+// Resize運行時調整連接池的最大連接數，縮小時關閉多餘的空閒連接
+// 最大連接數只是Get/Put判斷時使用的上限，空閒連接的環形隊列只在超過曾經達到的最大容量時擴容，縮小時只從隊首移除
+// 隊列保留曾經達到的最大容量，縮小後每個多出的位置仍佔用一個指針的內存，直到連接池釋放
+func (c *channelPool) Resize(newMaxCap int) error {
+	if newMaxCap <= 0 {
+		return errors.New("invalid capacity settings")
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+
+	// 優先關閉空閒最久的連接
+	var excess []*idleConn
+	for c.conns.len() > newMaxCap {
+		wrapConn := c.conns.popFront()
+		excess = append(excess, wrapConn)
+		c.forget(wrapConn.conn)
+	}
+	c.maxCap = newMaxCap
+	// 擴容後等待中的調用方可以創建新連接
+	c.wakeWaiters()
+	closeFun := c.close
+	c.unlock()
+
+	for _, wrapConn := range excess {
+		_ = c.closeConn(closeFun, wrapConn.conn)
+		callHook(c.onClose, wrapConn.conn)
+		if c.onEvict != nil {
+			c.onEvict(wrapConn.conn, EvictManual)
+		}
+	}
+
+	return nil
+}
+
+// Clone使用創建連接池時的配置初始化一個新的連接池，同樣按InitialCap創建初始連接，可用於新舊連接池的輪換
+// SetFactory/SetPing/SetClose替換的方法會沿用，Resize調整的最大連接數不會沿用，已釋放的連接池也可以Clone
+func (c *channelPool) Clone() (Pool, error) {
+	c.mu.Lock()
+	config := c.config
+	c.mu.Unlock()
+
+	return NewChannelPool(&config)
+}
+
+// WaitReady等待空閒連接數達到MinIdle，未設置MinIdle時為InitialCap，用於啟動時確認連接池已預熱
+// ctx取消或超時則返回ctx.Err()，連接池已釋放時返回ErrClosed
+func (c *channelPool) WaitReady(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if c.conns.len() >= c.readyCount() {
+		c.mu.Unlock()
+		return nil
+	}
+	ready := make(chan struct{})
+	c.readyWaiters = append(c.readyWaiters, ready)
+	c.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		c.mu.Lock()
+		for i, waiter := range c.readyWaiters {
+			if waiter == ready {
+				c.readyWaiters = append(c.readyWaiters[:i], c.readyWaiters[i+1:]...)
+				break
+			}
+		}
+		c.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Drain停止發放連接，等待所有使用中的連接放回後釋放連接池
+// ctx超時或取消時不再等待，直接釋放連接池並返回ctx.Err()；等待期間連接池被Release釋放時返回ErrClosed
+func (c *channelPool) Drain(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if !c.draining {
+		c.draining = true
+		c.drained = make(chan struct{})
+		c.wakeWaiters()
+	}
+	// checkDrained關閉drained後會將其清空，需先記錄
+	drained := c.drained
+	if drained == nil {
+		c.mu.Unlock()
+		return c.Release()
+	}
+	c.checkDrained()
+	c.mu.Unlock()
+
+	select {
+	case <-drained:
+		return c.Release()
+	case <-c.done:
+		return ErrClosed
+	case <-ctx.Done():
+		return errors.Join(ctx.Err(), c.Release())
+	}
+}
+
+// checkDrained在Drain期間所有連接都已放回時發出通知，需持有mu
+func (c *channelPool) checkDrained() {
+	if !c.draining || c.drained == nil {
+		return
+	}
+	if c.openConns-c.conns.len() <= 0 {
+		close(c.drained)
+		c.drained = nil
+	}
+}
+
+// HealthCheck使用Ping檢查所有空閒連接，關閉無效的連接並保持其餘連接的順序
+// 沒有可用的空閒連接時嘗試取出一個連接，仍然失敗則返回錯誤，未設置Ping時不做任何檢查
+func (c *channelPool) HealthCheck() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	ping := c.ping
+	if ping == nil {
+		c.mu.Unlock()
+		return nil
+	}
+	// 記錄空閒連接的快照，在鎖外Ping，避免阻塞其他調用方
+	// 連接仍留在連接池中，檢查期間可被取出、Reset或Evict；無法記錄的連接的包裝取出後會被復用，處理結果前需確認仍是同一條空閒連接
+	type candidate struct {
+		wrapConn  *idleConn
+		conn      interface{}
+		createdAt time.Time
+	}
+	candidates := make([]candidate, c.conns.len())
+	for i := range candidates {
+		wrapConn := c.conns.at(i)
+		candidates[i] = candidate{wrapConn, wrapConn.conn, wrapConn.createdAt}
+	}
+	c.mu.Unlock()
+
+	passed := make(map[*idleConn]time.Time, len(candidates))
+	failed := make(map[*idleConn]time.Time)
+	for _, cand := range candidates {
+		if err := ping(context.Background(), cand.conn); err != nil {
+			c.logger.Printf("conn is not able to be connected: %s", err)
+			failed[cand.wrapConn] = cand.createdAt
+			continue
+		}
+		passed[cand.wrapConn] = cand.createdAt
+	}
+
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	// 仍空閒的連接按檢查結果處理：通過的重新計算空閒時間，Meta會在鎖內讀取，需在鎖內更新；未通過的移出連接池
+	checked := c.now()
+	for i := 0; i < c.conns.len(); i++ {
+		wrapConn := c.conns.at(i)
+		if createdAt, ok := passed[wrapConn]; ok && wrapConn.createdAt.Equal(createdAt) {
+			wrapConn.t = checked
+		}
+	}
+	unhealthy := c.conns.filter(func(wrapConn *idleConn) bool {
+		createdAt, ok := failed[wrapConn]
+		return !ok || !wrapConn.createdAt.Equal(createdAt)
+	})
+	for _, wrapConn := range unhealthy {
+		c.forget(wrapConn.conn)
+	}
+	closeFun := c.close
+	n := c.conns.len()
+	c.unlock()
+
+	for _, wrapConn := range unhealthy {
+		_ = c.closeConn(closeFun, wrapConn.conn)
+		callHook(c.onClose, wrapConn.conn)
+		if c.onEvict != nil {
+			c.onEvict(wrapConn.conn, EvictPingFailed)
+		}
+	}
+
+	if n > 0 {
+		return nil
+	}
+
+	// 沒有空閒連接時確認能取得一個可用的連接
+	conn, err := c.Get()
+	if err != nil {
+		if conn != nil {
+			c.evict(conn, EvictPingFailed)
+		}
+		return fmt.Errorf("pool has no healthy connection: %w", err)
+	}
+	if err := ping(context.Background(), conn); err != nil {
+		c.evict(conn, EvictPingFailed)
+		return fmt.Errorf("pool has no healthy connection: %w", &PingError{Err: err})
+	}
+	c.Put(conn)
+
+	return nil
 }
@@ -0,0 +1,1620 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConfig返回使用*int作為連接的配置
+func testConfig(initialCap, maxCap int) *Config {
+	return &Config{
+		InitialCap: initialCap,
+		MaxCap:     maxCap,
+		Factory:    func() (interface{}, error) { return new(int), nil },
+		Close:      func(interface{}) error { return nil },
+	}
+}
+
+// closeCounter記錄每條連接被關閉的次數
+type closeCounter struct {
+	mu     sync.Mutex
+	closed map[interface{}]int
+}
+
+func (cc *closeCounter) close(conn interface{}) error {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if cc.closed == nil {
+		cc.closed = make(map[interface{}]int)
+	}
+	cc.closed[conn]++
+	return nil
+}
+
+// count連接被關閉的次數
+func (cc *closeCounter) count(conn interface{}) int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.closed[conn]
+}
+
+// total所有連接被關閉的總次數
+func (cc *closeCounter) total() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	n := 0
+	for _, times := range cc.closed {
+		n += times
+	}
+	return n
+}
+
+// fakeClock 可手動推進的時鐘，用於測試依賴時間的行為
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (f *fakeClock) now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.t
+}
+
+// advance將時鐘推進d
+func (f *fakeClock) advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.t = f.t.Add(d)
+}
+
+func TestMetaConcurrentWithGetPut(t *testing.T) {
+	config := testConfig(1, 1)
+	config.Ping = func(interface{}) error { return nil }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(conn)
+
+	started, done := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		close(started)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				p.Meta(conn)
+			}
+		}
+	}()
+	<-started
+	for i := 0; i < 10000; i++ {
+		c, err := p.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Put(c)
+	}
+	close(done)
+	wg.Wait()
+
+	meta, ok := p.Meta(conn)
+	if !ok || meta.Uses != 10001 {
+		t.Fatalf("Meta() = %+v, %v, want 10001 uses", meta, ok)
+	}
+}
+
+func TestUnhashableInterfaceField(t *testing.T) {
+	type wrapped struct{ v interface{} }
+	config := testConfig(1, 2)
+	config.Factory = func() (interface{}, error) { return wrapped{[]byte("x")}, nil }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 內含不可比較值的連接不能作為map的key，不被tracked記錄
+	if _, ok := p.Meta(conn); ok {
+		t.Fatal("Meta() reported unhashable connection as tracked")
+	}
+	if err := p.Put(conn); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Len(); got != 1 {
+		t.Fatalf("Len() = %d, want 1", got)
+	}
+}
+
+func TestReleaseDuringFill(t *testing.T) {
+	creating, unblock, closed := make(chan struct{}, 1), make(chan struct{}), make(chan struct{}, 1)
+	config := testConfig(0, 2)
+	config.MinIdle = 1
+	config.Factory = func() (interface{}, error) {
+		creating <- struct{}{}
+		<-unblock
+		return new(int), nil
+	}
+	config.Close = func(interface{}) error {
+		closed <- struct{}{}
+		return nil
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 後台補齊正在創建時釋放連接池
+	<-creating
+	p.Release()
+	close(unblock)
+	<-closed
+
+	if got := p.Len(); got != 0 {
+		t.Fatalf("Len() = %d, want 0", got)
+	}
+	if stats := p.Stats(); stats.TotalCreated != 1 || stats.TotalClosed != 1 {
+		t.Fatalf("Stats() created %d closed %d, want 1 and 1", stats.TotalCreated, stats.TotalClosed)
+	}
+}
+
+func TestReleaseDuringReset(t *testing.T) {
+	creating, unblock := make(chan struct{}, 1), make(chan struct{})
+	config := testConfig(1, 2)
+	created := 0
+	config.Factory = func() (interface{}, error) {
+		// 初始連接直接創建，Reset補齊時阻塞
+		if created++; created > 1 {
+			creating <- struct{}{}
+			<-unblock
+		}
+		return new(int), nil
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reset := make(chan error)
+	go func() { reset <- p.Reset() }()
+	<-creating
+	p.Release()
+	close(unblock)
+	if err := <-reset; err != nil {
+		t.Fatal(err)
+	}
+
+	if got := p.Len(); got != 0 {
+		t.Fatalf("Len() = %d, want 0", got)
+	}
+	if stats := p.Stats(); stats.TotalCreated != 2 || stats.TotalClosed != 2 {
+		t.Fatalf("Stats() created %d closed %d, want 2 and 2", stats.TotalCreated, stats.TotalClosed)
+	}
+}
+
+func TestPutRacesRelease(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		p, err := NewChannelPool(testConfig(0, 16))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conns := make([]interface{}, 16)
+		for i := range conns {
+			if conns[i], err = p.Get(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, conn := range conns {
+			wg.Add(1)
+			go func(conn interface{}) {
+				defer wg.Done()
+				p.Put(conn)
+			}(conn)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Release()
+		}()
+		wg.Wait()
+
+		if got := p.Len(); got != 0 {
+			t.Fatalf("Len() = %d after Release, want 0", got)
+		}
+	}
+}
+
+func TestPutFullPoolDoesNotBlock(t *testing.T) {
+	var cc closeCounter
+	config := testConfig(0, 2)
+	config.MaxIdle = 1
+	config.Close = cc.close
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	first, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Put(first); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- p.Put(second) }()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrPoolFull) {
+			t.Fatalf("Put() error = %v, want ErrPoolFull", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Put() blocked on a full pool")
+	}
+	if cc.count(second) != 1 {
+		t.Fatal("Put() did not close the connection rejected by a full pool")
+	}
+	if got := p.Len(); got != 1 {
+		t.Fatalf("Len() = %d, want 1", got)
+	}
+}
+
+func TestLazyInitialCapZero(t *testing.T) {
+	created := 0
+	config := testConfig(0, 3)
+	config.Factory = func() (interface{}, error) {
+		created++
+		return new(int), nil
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	if got := p.Len(); got != 0 || created != 0 {
+		t.Fatalf("Len() = %d with %d created, want an empty pool", got, created)
+	}
+
+	conns := make([]interface{}, 3)
+	for i := range conns {
+		if conns[i], err = p.Get(); err != nil {
+			t.Fatal(err)
+		}
+		if created != i+1 {
+			t.Fatalf("Get() #%d created %d connections, want %d", i+1, created, i+1)
+		}
+	}
+	if _, err := p.Get(); !errors.Is(err, ErrMaxActiveConnReached) {
+		t.Fatalf("Get() at MaxCap error = %v, want ErrMaxActiveConnReached", err)
+	}
+
+	for i, conn := range conns {
+		if err := p.Put(conn); err != nil {
+			t.Fatal(err)
+		}
+		if got := p.IdleLen(); got != i+1 {
+			t.Fatalf("IdleLen() = %d after %d Puts, want %d", got, i+1, i+1)
+		}
+	}
+	if got := p.Len(); got != 3 {
+		t.Fatalf("Len() = %d, want 3", got)
+	}
+
+	// 空閒連接被復用，不再創建新連接
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(conn)
+	if created != 3 {
+		t.Fatalf("created %d connections, want 3", created)
+	}
+}
+
+func TestGetRacesRelease(t *testing.T) {
+	for round := 0; round < 50; round++ {
+		var cc closeCounter
+		config := testConfig(4, 8)
+		config.Close = cc.close
+		p, err := NewChannelPool(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			wg  sync.WaitGroup
+			mu  sync.Mutex
+			got []interface{}
+		)
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				conn, err := p.Get()
+				if err != nil {
+					if !errors.Is(err, ErrClosed) {
+						t.Error(err)
+					}
+					return
+				}
+				mu.Lock()
+				got = append(got, conn)
+				mu.Unlock()
+			}()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Release()
+		}()
+		wg.Wait()
+
+		// 釋放後放回的連接被關閉，所有連接最終都恰好關閉一次
+		for _, conn := range got {
+			p.Put(conn)
+		}
+		if n := p.Len(); n != 0 {
+			t.Fatalf("Len() = %d after Release, want 0", n)
+		}
+		if stats := p.Stats(); int(stats.TotalCreated) != cc.total() {
+			t.Fatalf("created %d connections, closed %d", stats.TotalCreated, cc.total())
+		}
+	}
+}
+
+func TestMetaSurvivesGetPutCycles(t *testing.T) {
+	clock := newFakeClock()
+	created := clock.now()
+	p, err := newChannelPool(testConfig(2, 2), clock.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	var conns []interface{}
+	for i := 0; i < 100; i++ {
+		clock.advance(time.Second)
+		conns = conns[:0]
+		for j := 0; j < 2; j++ {
+			conn, err := p.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			conns = append(conns, conn)
+		}
+		for _, conn := range conns {
+			if err := p.Put(conn); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	for _, conn := range conns {
+		meta, ok := p.Meta(conn)
+		if !ok {
+			t.Fatal("Meta() lost track of a pooled connection")
+		}
+		if meta.Uses != 100 || !meta.CreatedAt.Equal(created) || !meta.IdleSince.Equal(clock.now()) {
+			t.Fatalf("Meta() = %+v, want 100 uses, created at %v, idle since %v", meta, created, clock.now())
+		}
+	}
+	if stats := p.Stats(); stats.TotalCreated != 2 {
+		t.Fatalf("created %d connections, want 2", stats.TotalCreated)
+	}
+}
+
+func TestConcurrentRelease(t *testing.T) {
+	var cc closeCounter
+	config := testConfig(8, 8)
+	config.Close = cc.close
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idle []interface{}
+	p.InspectIdle(func(conn interface{}, _ time.Time) {
+		idle = append(idle, conn)
+	})
+	if len(idle) != 8 {
+		t.Fatalf("InspectIdle() found %d connections, want 8", len(idle))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Release()
+		}()
+	}
+	wg.Wait()
+
+	for _, conn := range idle {
+		if n := cc.count(conn); n != 1 {
+			t.Fatalf("connection closed %d times, want once", n)
+		}
+	}
+	if !p.IsClosed() {
+		t.Fatal("IsClosed() = false after Release")
+	}
+}
+
+func TestCancelledWaiterRepoolsConnection(t *testing.T) {
+	var cc closeCounter
+	config := testConfig(1, 1)
+	config.Blocking = true
+	config.Close = cc.close
+	var (
+		p      Pool
+		held   interface{}
+		cancel context.CancelFunc
+	)
+	// 等待者入隊後立即放回連接並取消ctx，使連接到達與取消同時發生
+	config.OnEnqueue = func(int) {
+		p.Put(held)
+		cancel()
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	cancelled := 0
+	for i := 0; i < 200; i++ {
+		if held, err = p.Get(); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancelCtx := context.WithCancel(context.Background())
+		cancel = cancelCtx
+		conn, err := p.GetContext(ctx)
+		cancelCtx()
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Fatal(err)
+			}
+			cancelled++
+			// 放棄等待前已收到的連接需放回池中
+			if got := p.IdleLen(); got != 1 {
+				t.Fatalf("IdleLen() = %d after cancelled Get, want 1", got)
+			}
+			continue
+		}
+		p.Put(conn)
+	}
+	if n := cc.total(); n != 0 {
+		t.Fatalf("closed %d connections, want 0", n)
+	}
+	if got := p.Len(); got != 1 {
+		t.Fatalf("Len() = %d, want 1", got)
+	}
+	t.Logf("%d of 200 waits were cancelled", cancelled)
+}
+
+func TestStatsAfterRelease(t *testing.T) {
+	config := testConfig(2, 4)
+	config.Name = "db"
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns := make([]interface{}, 3)
+	for i := range conns {
+		if conns[i], err = p.Get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p.Put(conns[0])
+	p.Release()
+	// 釋放後放回的連接被關閉，也計入累計關閉數
+	p.Put(conns[1])
+	p.Put(conns[2])
+
+	stats := p.Stats()
+	if !p.IsClosed() || p.Len() != 0 {
+		t.Fatalf("IsClosed() = %v, Len() = %d after Release", p.IsClosed(), p.Len())
+	}
+	if stats.Name != "db" || stats.TotalCreated != 3 || stats.TotalClosed != 3 || stats.IdleCount != 0 {
+		t.Fatalf("Stats() = %+v, want db with 3 created and 3 closed", stats)
+	}
+}
+
+func TestValidatedConnSurvivesIdleTimeout(t *testing.T) {
+	var cc closeCounter
+	clock := newFakeClock()
+	config := testConfig(1, 1)
+	config.IdleTimeout = 10 * time.Second
+	config.Ping = func(interface{}) error { return nil }
+	config.Close = cc.close
+	p, err := newChannelPool(config, clock.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(conn)
+
+	// 即將超過IdleTimeout時通過檢查，空閒時間從檢查時重新計算
+	clock.advance(9 * time.Second)
+	if err := p.HealthCheck(); err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(2 * time.Second)
+	got, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != conn || cc.count(conn) != 0 {
+		t.Fatal("Get() closed a connection validated before IdleTimeout")
+	}
+	p.Put(got)
+
+	// 檢查之後超過IdleTimeout的連接仍會被關閉
+	clock.advance(11 * time.Second)
+	if got, err = p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if got == conn || cc.count(conn) != 1 {
+		t.Fatal("Get() returned a connection idle longer than IdleTimeout")
+	}
+}
+
+func TestCloseTwiceAndForeign(t *testing.T) {
+	var cc closeCounter
+	config := testConfig(0, 2)
+	config.Close = cc.close
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Len(); got != 1 {
+		t.Fatalf("Len() = %d, want 1", got)
+	}
+
+	p.Close(conn)
+	p.Close(conn)
+	p.Close(new(int))
+	if got := p.Len(); got != 0 {
+		t.Fatalf("Len() = %d after closing twice and a foreign connection, want 0", got)
+	}
+	if stats := p.Stats(); stats.TotalClosed != 1 {
+		t.Fatalf("TotalClosed = %d, want 1", stats.TotalClosed)
+	}
+
+	// 計數未被重複扣減，連接數仍不超過MaxCap
+	for i := 0; i < 2; i++ {
+		if _, err := p.Get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := p.Get(); !errors.Is(err, ErrMaxActiveConnReached) {
+		t.Fatalf("Get() beyond MaxCap error = %v, want ErrMaxActiveConnReached", err)
+	}
+}
+
+func TestGetAfterReleaseReturnsPromptly(t *testing.T) {
+	config := testConfig(1, 1)
+	config.Blocking = true
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 佔用唯一的連接，使並發的Get阻塞等待
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		go func() {
+			_, err := p.Get()
+			errs <- err
+		}()
+	}
+	go p.Release()
+
+	for i := 0; i < 8; i++ {
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ErrClosed) {
+				t.Fatalf("Get() error = %v, want ErrClosed", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Get() did not return after Release")
+		}
+	}
+	if _, err := p.Get(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get() after Release error = %v, want ErrClosed", err)
+	}
+}
+
+func TestMaxUsesRecycles(t *testing.T) {
+	var cc closeCounter
+	config := testConfig(1, 1)
+	config.MaxUses = 3
+	config.Close = cc.close
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	first, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(first)
+	for i := 2; i <= 3; i++ {
+		conn, err := p.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn != first {
+			t.Fatalf("checkout #%d returned a new connection, want the original until MaxUses", i)
+		}
+		p.Put(conn)
+	}
+	if cc.count(first) != 0 {
+		t.Fatal("connection closed before reaching MaxUses")
+	}
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn == first || cc.count(first) != 1 {
+		t.Fatal("connection was not recycled after MaxUses checkouts")
+	}
+	if meta, _ := p.Meta(conn); meta.Uses != 1 {
+		t.Fatalf("new connection has %d uses, want 1", meta.Uses)
+	}
+	p.Put(conn)
+}
+
+func TestPutAfterRelease(t *testing.T) {
+	errClose := errors.New("close failed")
+	var (
+		cc     closeCounter
+		second interface{}
+	)
+	config := testConfig(0, 2)
+	config.Close = func(conn interface{}) error {
+		cc.close(conn)
+		if conn == second {
+			return errClose
+		}
+		return nil
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err = p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	p.Release()
+
+	if err := p.Put(first); err != ErrClosed {
+		t.Fatalf("Put() after Release error = %v, want ErrClosed", err)
+	}
+	if cc.count(first) != 1 {
+		t.Fatal("Put() after Release did not close the connection")
+	}
+
+	// 關閉失敗的錯誤與ErrClosed一併返回
+	if err := p.Put(second); !errors.Is(err, ErrClosed) || !errors.Is(err, errClose) {
+		t.Fatalf("Put() after Release error = %v, want ErrClosed wrapping the close error", err)
+	}
+}
+
+// countLogger記錄輸出的日誌條數
+type countLogger struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (l *countLogger) Printf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.n++
+}
+
+func TestReleaseSurvivesPanickingClose(t *testing.T) {
+	var (
+		cc       closeCounter
+		logger   countLogger
+		panicked interface{}
+		hookErrs int
+	)
+	config := testConfig(3, 3)
+	config.Logger = &logger
+	config.Close = func(conn interface{}) error {
+		cc.close(conn)
+		if panicked == nil {
+			panicked = conn
+			panic("already closed")
+		}
+		return nil
+	}
+	config.OnReleaseCloseError = func(conn interface{}, err error) {
+		if conn == panicked {
+			hookErrs++
+		}
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.Release()
+	var closeErr *CloseError
+	if !errors.As(err, &closeErr) || closeErr.Conn != panicked {
+		t.Fatalf("Release() error = %v, want a CloseError for the panicking connection", err)
+	}
+	// 其餘連接仍被關閉
+	if n := cc.total(); n != 3 {
+		t.Fatalf("closed %d connections, want 3", n)
+	}
+	if hookErrs != 1 {
+		t.Fatalf("OnReleaseCloseError called %d times for the panicking connection, want 1", hookErrs)
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if logger.n == 0 {
+		t.Fatal("recovered panic was not logged")
+	}
+}
+
+func TestPartialFillClosesCreated(t *testing.T) {
+	for _, parallel := range []bool{false, true} {
+		var (
+			cc      closeCounter
+			mu      sync.Mutex
+			calls   int
+			created int
+		)
+		config := testConfig(10, 10)
+		config.ParallelFill = parallel
+		config.Close = cc.close
+		// 第5次創建失敗
+		config.Factory = func() (interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if calls++; calls == 5 {
+				return nil, errors.New("dial failed")
+			}
+			created++
+			return new(int), nil
+		}
+		if _, err := NewChannelPool(config); err == nil {
+			t.Fatal("NewChannelPool() succeeded with a failing factory")
+		}
+
+		mu.Lock()
+		if n := cc.total(); n != created {
+			t.Fatalf("parallel=%v: closed %d connections, created %d", parallel, n, created)
+		}
+		mu.Unlock()
+	}
+}
+
+func TestPingWithoutPingFunc(t *testing.T) {
+	p, err := NewChannelPool(testConfig(1, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinger, ok := p.(interface{ Ping(interface{}) error })
+	if !ok {
+		t.Fatal("pool does not expose Ping")
+	}
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pinger.Ping(conn); err != nil {
+		t.Fatalf("Ping() without a ping func error = %v, want nil", err)
+	}
+	p.Put(conn)
+	p.Release()
+	if err := pinger.Ping(conn); err != nil {
+		t.Fatalf("Ping() after Release error = %v, want nil", err)
+	}
+}
+
+func TestDatabaseSQLTimeouts(t *testing.T) {
+	t.Run("ConnMaxIdleTime", func(t *testing.T) {
+		var cc closeCounter
+		clock := newFakeClock()
+		config := testConfig(1, 1)
+		config.ConnMaxIdleTime = 10 * time.Second
+		// 兩者都設置時以ConnMaxIdleTime為準
+		config.IdleTimeout = time.Hour
+		config.Close = cc.close
+		p, err := newChannelPool(config, clock.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Release()
+
+		// 與database/sql相同，空閒時間從最近一次放回起計算，經常使用的連接不會因存活時間長而被關閉
+		conn, _ := p.Get()
+		for i := 0; i < 5; i++ {
+			p.Put(conn)
+			clock.advance(9 * time.Second)
+			got, err := p.Get()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != conn {
+				t.Fatalf("Get() #%d returned a new connection before ConnMaxIdleTime", i+1)
+			}
+		}
+		p.Put(conn)
+		clock.advance(11 * time.Second)
+		if got, _ := p.Get(); got == conn || cc.count(conn) != 1 {
+			t.Fatal("connection idle longer than ConnMaxIdleTime was not closed")
+		}
+	})
+
+	t.Run("ConnMaxLifetime", func(t *testing.T) {
+		var cc closeCounter
+		clock := newFakeClock()
+		config := testConfig(1, 1)
+		config.ConnMaxLifetime = 30 * time.Second
+		// 兩者都設置時以ConnMaxLifetime為準
+		config.MaxConnLifetime = time.Hour
+		config.Close = cc.close
+		p, err := newChannelPool(config, clock.now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer p.Release()
+
+		// 與database/sql相同，存活時間從創建起計算，剛放回的連接超過存活時間也會被關閉
+		conn, _ := p.Get()
+		clock.advance(29 * time.Second)
+		p.Put(conn)
+		if got, _ := p.Get(); got != conn {
+			t.Fatal("Get() closed a connection younger than ConnMaxLifetime")
+		}
+		clock.advance(2 * time.Second)
+		p.Put(conn)
+		if got, _ := p.Get(); got == conn || cc.count(conn) != 1 {
+			t.Fatal("connection older than ConnMaxLifetime was not closed")
+		}
+	})
+}
+
+func TestAllUnhealthyAtCapacity(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		bad = map[interface{}]bool{}
+	)
+	config := testConfig(0, 2)
+	config.Blocking = true
+	config.PingOnPut = true
+	// 放回時後端已不可用，之前創建的連接都無法通過檢查
+	config.Ping = func(conn interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if bad[conn] {
+			return errors.New("backend down")
+		}
+		return nil
+	}
+	enqueued := make(chan struct{}, 1)
+	config.OnEnqueue = func(int) { enqueued <- struct{}{} }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	held := make([]interface{}, 2)
+	for i := range held {
+		if held[i], err = p.Get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mu.Lock()
+	for _, conn := range held {
+		bad[conn] = true
+	}
+	mu.Unlock()
+
+	got := make(chan interface{})
+	go func() {
+		conn, err := p.Get()
+		if err != nil {
+			t.Error(err)
+		}
+		got <- conn
+	}()
+	// 等待者入隊後再放回無效的連接
+	<-enqueued
+	for _, conn := range held {
+		p.Put(conn)
+	}
+
+	select {
+	case conn := <-got:
+		mu.Lock()
+		defer mu.Unlock()
+		if conn == nil || bad[conn] {
+			t.Fatal("Get() did not create a new connection after the unhealthy ones were closed")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Get() hung after every connection at capacity failed validation")
+	}
+}
+
+func TestReleaseJoinsCloseErrors(t *testing.T) {
+	errs := map[interface{}]error{}
+	config := testConfig(3, 3)
+	config.Close = func(conn interface{}) error { return errs[conn] }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 創建完成後為每條連接設置不同的關閉錯誤
+	p.InspectIdle(func(conn interface{}, _ time.Time) {
+		errs[conn] = fmt.Errorf("close %p failed", conn)
+	})
+
+	err = p.Release()
+	for conn, closeErr := range errs {
+		if !errors.Is(err, closeErr) {
+			t.Fatalf("Release() error %v does not include %v", err, closeErr)
+		}
+		found := false
+		for _, joined := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var ce *CloseError
+			if errors.As(joined, &ce) && ce.Conn == conn && ce.Err == closeErr {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("Release() error has no CloseError for %p", conn)
+		}
+	}
+}
+
+func TestEvictJoinsCloseErrors(t *testing.T) {
+	errClose := errors.New("close failed")
+	config := testConfig(3, 3)
+	config.Close = func(interface{}) error { return errClose }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	n, err := p.Evict(func(interface{}) bool { return true })
+	if n != 3 {
+		t.Fatalf("Evict() closed %d connections, want 3", n)
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok || len(joined.Unwrap()) != 3 || !errors.Is(err, errClose) {
+		t.Fatalf("Evict() error = %v, want 3 joined close errors", err)
+	}
+}
+
+func TestStartupHealthCheckFails(t *testing.T) {
+	var (
+		cc    closeCounter
+		mu    sync.Mutex
+		conns []interface{}
+	)
+	config := testConfig(3, 3)
+	config.StartupHealthCheck = true
+	config.Close = cc.close
+	config.Factory = func() (interface{}, error) {
+		conn := new(int)
+		mu.Lock()
+		conns = append(conns, conn)
+		mu.Unlock()
+		return conn, nil
+	}
+	// 第二條初始連接無法通過檢查
+	config.Ping = func(conn interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if conn == conns[1] {
+			return errors.New("backend down")
+		}
+		return nil
+	}
+	if _, err := NewChannelPool(config); err == nil {
+		t.Fatal("NewChannelPool() succeeded with an unhealthy initial connection")
+	}
+	for _, conn := range conns {
+		if n := cc.count(conn); n != 1 {
+			t.Fatalf("initial connection closed %d times, want once", n)
+		}
+	}
+
+	// 沒有設置Ping時不做檢查
+	config.Ping = nil
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release()
+}
+
+func BenchmarkCloseContention(b *testing.B) {
+	config := testConfig(1, 1<<20)
+	config.Close = func(interface{}) error {
+		time.Sleep(time.Millisecond)
+		return nil
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer p.Release()
+
+	// 後台持續關閉連接，close在鎖外調用，不會拖慢同時進行的Get/Put
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				conn, err := p.Get()
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				p.Close(conn)
+			}
+		}()
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn, err := p.Get()
+		if err != nil {
+			b.Fatal(err)
+		}
+		p.Put(conn)
+	}
+	b.StopTimer()
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkGetPutAllocs(b *testing.B) {
+	for _, bench := range []struct {
+		name    string
+		factory func() (interface{}, error)
+	}{
+		{"hashable", func() (interface{}, error) { return new(int), nil }},
+		// 切片不能作為map的key，每次放回都需要包裝，包裝從idleConnPool復用
+		{"unhashable", func() (interface{}, error) { return make([]byte, 8), nil }},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			config := testConfig(1, 1)
+			config.Factory = bench.factory
+			p, err := NewChannelPool(config)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer p.Release()
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				conn, err := p.Get()
+				if err != nil {
+					b.Fatal(err)
+				}
+				p.Put(conn)
+			}
+		})
+	}
+}
+
+func TestReapWithFakeClock(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		evicted = map[interface{}]EvictReason{}
+	)
+	clock := newFakeClock()
+	config := testConfig(2, 2)
+	config.IdleTimeout = 10 * time.Second
+	config.MaxConnLifetime = 30 * time.Second
+	config.LIFO = true
+	config.OnEvict = func(conn interface{}, reason EvictReason) {
+		mu.Lock()
+		defer mu.Unlock()
+		evicted[conn] = reason
+	}
+	p, err := newChannelPool(config, clock.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	// 每隔8秒取出並放回一條連接，使其不超過IdleTimeout，另一條一直空閒
+	var active interface{}
+	for i := 0; i < 3; i++ {
+		clock.advance(8 * time.Second)
+		if active, err = p.Get(); err != nil {
+			t.Fatal(err)
+		}
+		p.Put(active)
+		p.reap()
+	}
+	if idle, _ := p.OldestIdle(); idle != 0 {
+		t.Fatalf("OldestIdle() = %v, want 0", idle)
+	}
+	mu.Lock()
+	if len(evicted) != 1 {
+		t.Fatalf("evicted %v, want only the unused connection for idle timeout", evicted)
+	}
+	for conn, reason := range evicted {
+		if conn == active || reason != EvictIdleTimeout {
+			t.Fatalf("evicted %v, want only the unused connection for idle timeout", evicted)
+		}
+	}
+	mu.Unlock()
+
+	// 經常使用的連接仍在創建30秒後被關閉
+	clock.advance(7 * time.Second)
+	p.reap()
+	if got := p.Len(); got != 0 {
+		t.Fatalf("Len() = %d after MaxConnLifetime, want 0", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if reason, ok := evicted[active]; !ok || reason != EvictMaxLifetime {
+		t.Fatalf("active connection evicted with %v, %v, want EvictMaxLifetime", reason, ok)
+	}
+}
+
+// concurrentGetMany兩個調用方同時反覆取出3個連接，最大連接數為4時逐個進行才能完成
+func concurrentGetMany(t *testing.T, p Pool) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var wg sync.WaitGroup
+		for g := 0; g < 2; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					conns, err := p.GetMany(3)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					p.PutAll(conns)
+				}
+			}()
+		}
+		wg.Wait()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("concurrent GetMany deadlocked")
+	}
+}
+
+func TestConcurrentGetManyBlocking(t *testing.T) {
+	config := testConfig(0, 4)
+	config.Blocking = true
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	concurrentGetMany(t, p)
+}
+
+func TestDrain(t *testing.T) {
+	// drainAsync在後台調用Drain，最多等待一秒
+	drainAsync := func(p Pool) chan error {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		done := make(chan error, 1)
+		go func() {
+			defer cancel()
+			done <- p.Drain(ctx)
+		}()
+		return done
+	}
+
+	t.Run("idle", func(t *testing.T) {
+		p, err := NewChannelPool(testConfig(2, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-drainAsync(p); err != nil {
+			t.Fatalf("Drain() with no checked-out connections error = %v, want nil", err)
+		}
+		if !p.IsClosed() {
+			t.Fatal("IsClosed() = false after Drain")
+		}
+	})
+
+	t.Run("put", func(t *testing.T) {
+		p, err := NewChannelPool(testConfig(2, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn, err := p.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := drainAsync(p)
+		time.Sleep(10 * time.Millisecond)
+		p.Put(conn)
+		if err := <-done; err != nil {
+			t.Fatalf("Drain() error = %v, want nil", err)
+		}
+	})
+
+	t.Run("released", func(t *testing.T) {
+		p, err := NewChannelPool(testConfig(2, 2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Get(); err != nil {
+			t.Fatal(err)
+		}
+		done := drainAsync(p)
+		time.Sleep(10 * time.Millisecond)
+		p.Release()
+		select {
+		case err := <-done:
+			if !errors.Is(err, ErrClosed) {
+				t.Fatalf("Drain() error = %v after Release, want ErrClosed", err)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Fatal("Drain() kept waiting after Release")
+		}
+	})
+}
+
+func TestTinyLeakDetectionThreshold(t *testing.T) {
+	config := testConfig(1, 1)
+	config.LeakDetectionThreshold = 1
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release()
+}
+
+func TestHealthCheckLeavesConnectionsPooled(t *testing.T) {
+	var (
+		cc      closeCounter
+		mu      sync.Mutex
+		pinging chan struct{}
+		resume  chan struct{}
+	)
+	config := testConfig(2, 2)
+	config.Close = cc.close
+	// 設置pinging後下一次Ping阻塞，直到resume關閉
+	config.Ping = func(interface{}) error {
+		mu.Lock()
+		started, wait := pinging, resume
+		pinging = nil
+		mu.Unlock()
+		if started != nil {
+			close(started)
+			<-wait
+		}
+		return nil
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	// checking在HealthCheck的Ping阻塞期間調用fn
+	checking := func(fn func()) {
+		t.Helper()
+		mu.Lock()
+		pinging, resume = make(chan struct{}), make(chan struct{})
+		started, wait := pinging, resume
+		mu.Unlock()
+		done := make(chan error)
+		go func() { done <- p.HealthCheck() }()
+		<-started
+		fn()
+		close(wait)
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var old []interface{}
+	p.InspectIdle(func(conn interface{}, _ time.Time) { old = append(old, conn) })
+
+	checking(func() {
+		// 檢查期間空閒連接仍可取出
+		conn, ok, err := p.TryGet()
+		if err != nil || !ok {
+			t.Fatalf("TryGet() during HealthCheck = %v, %v, want an idle connection", ok, err)
+		}
+		p.Put(conn)
+		if err := p.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	for _, conn := range old {
+		if cc.count(conn) != 1 {
+			t.Fatal("Reset() during HealthCheck did not close the old connections")
+		}
+	}
+	var fresh []interface{}
+	p.InspectIdle(func(conn interface{}, _ time.Time) { fresh = append(fresh, conn) })
+	if len(fresh) != 2 || fresh[0] == old[0] || fresh[0] == old[1] {
+		t.Fatalf("idle connections after Reset = %v, want 2 new connections", fresh)
+	}
+
+	checking(func() {
+		if n, err := p.Evict(func(interface{}) bool { return true }); n != 2 || err != nil {
+			t.Fatalf("Evict() during HealthCheck = %d, %v, want 2", n, err)
+		}
+	})
+	for _, conn := range fresh {
+		if cc.count(conn) != 1 {
+			t.Fatal("Evict() during HealthCheck did not close the connections")
+		}
+	}
+}
+
+func TestInitialFillRetriesPrepare(t *testing.T) {
+	var cc closeCounter
+	prepares := 0
+	config := testConfig(1, 1)
+	config.FactoryRetries = 2
+	config.Close = cc.close
+	// 第一條連接Prepare失敗，當作創建失敗重試
+	config.Prepare = func(interface{}) error {
+		if prepares++; prepares == 1 {
+			return errors.New("prepare failed")
+		}
+		return nil
+	}
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatalf("NewChannelPool() error = %v, want the Prepare failure retried", err)
+	}
+	defer p.Release()
+	if prepares != 2 || cc.total() != 1 || p.Len() != 1 {
+		t.Fatalf("prepared %d, closed %d, Len() = %d, want 2, 1 and 1", prepares, cc.total(), p.Len())
+	}
+}
+
+func TestCancelDuringPingRepools(t *testing.T) {
+	var (
+		cc      closeCounter
+		evicted int
+	)
+	pinging := make(chan struct{}, 1)
+	config := testConfig(1, 1)
+	config.Close = cc.close
+	// Ping等待ctx取消，模擬較慢的檢查
+	config.PingContext = func(ctx context.Context, _ interface{}) error {
+		pinging <- struct{}{}
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	config.OnEvict = func(interface{}, EvictReason) { evicted++ }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-pinging
+		cancel()
+	}()
+	if _, err := p.GetContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetContext() error = %v, want context.Canceled", err)
+	}
+	if cc.total() != 0 || evicted != 0 {
+		t.Fatalf("closed %d and evicted %d connections after a cancelled Ping, want 0", cc.total(), evicted)
+	}
+	if got := p.IdleLen(); got != 1 {
+		t.Fatalf("IdleLen() = %d after a cancelled Ping, want 1", got)
+	}
+}
+
+func TestHighWaterRearmsAfterClose(t *testing.T) {
+	fired := 0
+	config := testConfig(0, 10)
+	config.HighWaterMark = 0.5
+	config.OnHighWater = func() { fired++ }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	conns := make([]interface{}, 5)
+	for i := range conns {
+		if conns[i], err = p.Get(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 關閉一條連接回落到高水位以下，再次升至高水位時重新調用
+	p.Close(conns[0])
+	if _, err := p.Get(); err != nil {
+		t.Fatal(err)
+	}
+	if fired != 2 {
+		t.Fatalf("OnHighWater called %d times, want 2", fired)
+	}
+}
+
+func TestLongCheckoutIsNotIdle(t *testing.T) {
+	var cc closeCounter
+	clock := newFakeClock()
+	config := testConfig(1, 1)
+	config.ConnMaxIdleTime = 10 * time.Second
+	config.Close = cc.close
+	p, err := newChannelPool(config, clock.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	// 與database/sql相同，被取出的時間不算作空閒
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(11 * time.Second)
+	if err := p.Put(conn); err != nil {
+		t.Fatalf("Put() after a long checkout error = %v, want nil", err)
+	}
+	if got, _ := p.Get(); got != conn || cc.count(conn) != 0 {
+		t.Fatal("connection busy longer than ConnMaxIdleTime was closed")
+	}
+}
+
+func TestPutDiscardedReturnsError(t *testing.T) {
+	var cc closeCounter
+	clock := newFakeClock()
+	config := testConfig(0, 2)
+	config.ConnMaxLifetime = 10 * time.Second
+	config.Close = cc.close
+	p, err := newChannelPool(config, clock.now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	// Reset之前取出的連接
+	stale, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Put(stale); !errors.Is(err, ErrConnDiscarded) {
+		t.Fatalf("Put() after Reset error = %v, want ErrConnDiscarded", err)
+	}
+
+	// 超過最長存活時間的連接
+	old, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.advance(11 * time.Second)
+	if err := p.Put(old); !errors.Is(err, ErrConnDiscarded) {
+		t.Fatalf("Put() past ConnMaxLifetime error = %v, want ErrConnDiscarded", err)
+	}
+	if cc.count(stale) != 1 || cc.count(old) != 1 {
+		t.Fatal("Put() did not close the discarded connections")
+	}
+	if got := p.Len(); got != 0 {
+		t.Fatalf("Len() = %d, want 0", got)
+	}
+}
+
+func TestGetWithTimeoutDuringFactoryRetryDelay(t *testing.T) {
+	var calls int32
+	config := testConfig(0, 1)
+	config.Factory = func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errors.New("backend unavailable")
+	}
+	config.FactoryRetries = 3
+	config.FactoryRetryDelay = time.Second
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	// 超時發生在等待重試期間，應報告超時而非factory的錯誤
+	start := time.Now()
+	if _, err := p.GetWithTimeout(20 * time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("GetWithTimeout() error = %v, want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("GetWithTimeout() took %v, want it to stop at the deadline", elapsed)
+	}
+
+	// ctx已結束時即使沒有重試延遲也不再重試
+	config.FactoryRetryDelay = 0
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel := context.WithCancel(context.Background())
+	config.Factory = func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		cancel()
+		return nil, errors.New("backend unavailable")
+	}
+	q, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Release()
+	if _, err := q.GetContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetContext() error = %v, want context.Canceled", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Fatalf("factory called %d times after ctx was cancelled, want 1", got)
+	}
+}
@@ -0,0 +1,92 @@
+package pool
+
+import "sync"
+
+// PooledConn 從連接池取出的連接，Close時自動放回連接池，可直接defer Close
+type PooledConn struct {
+	// 底層連接
+	Conn interface{}
+
+	p        Pool
+	mu       sync.Mutex
+	consumed bool
+}
+
+// Acquire從池中取一個連接並包裝為PooledConn，返回ErrDegraded時同時返回連接
+func Acquire(p Pool) (*PooledConn, error) {
+	conn, err := p.Get()
+	if conn == nil {
+		return nil, err
+	}
+
+	return &PooledConn{Conn: conn, p: p}, err
+}
+
+// consume標記連接已歸還，重複調用返回false
+func (pc *PooledConn) consume() bool {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if pc.consumed {
+		return false
+	}
+	pc.consumed = true
+	return true
+}
+
+// Close將連接放回連接池，重複調用返回ErrConnReleased
+func (pc *PooledConn) Close() error {
+	if !pc.consume() {
+		return ErrConnReleased
+	}
+
+	return pc.p.Put(pc.Conn)
+}
+
+// Discard關閉底層連接而不放回連接池，用於連接已損壞的情況
+func (pc *PooledConn) Discard() error {
+	if !pc.consume() {
+		return ErrConnReleased
+	}
+
+	return pc.p.Close(pc.Conn)
+}
+
+// Do從池中取一個連接並調用fn，fn返回isRetriable判斷為連接已損壞的錯誤時關閉該連接並換用新連接重試，最多重試retries次
+// 其餘情況將連接放回連接池並返回fn的錯誤；fn發生panic時關閉該連接後繼續panic
+func Do(p Pool, retries int, fn func(conn interface{}) error, isRetriable func(error) bool) error {
+	for i := 0; ; i++ {
+		conn, err := p.Get()
+		if err != nil {
+			// 未通過Ping的連接不交給fn使用
+			if conn != nil {
+				p.Close(conn)
+			}
+			return err
+		}
+
+		err = call(p, conn, fn)
+		if err != nil && isRetriable != nil && isRetriable(err) {
+			p.Close(conn)
+			if i < retries {
+				continue
+			}
+			return err
+		}
+
+		p.Put(conn)
+		return err
+	}
+}
+
+// call調用fn，fn發生panic時關閉連接，避免連接洩漏
+func call(p Pool, conn interface{}, fn func(conn interface{}) error) error {
+	defer func() {
+		if r := recover(); r != nil {
+			p.Close(conn)
+			panic(r)
+		}
+	}()
+
+	return fn(conn)
+}
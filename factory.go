@@ -0,0 +1,51 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+)
+
+// multiFactory在多個factory之間選擇一個創建連接
+// 未設置權重時輪詢，設置權重時按權重隨機選擇
+func multiFactory(factories []func() (interface{}, error), weights []int) (func(context.Context) (interface{}, error), error) {
+	for _, factory := range factories {
+		if factory == nil {
+			return nil, errors.New("invalid factory func settings")
+		}
+	}
+
+	if len(weights) == 0 {
+		var next uint64
+		return func(context.Context) (interface{}, error) {
+			i := atomic.AddUint64(&next, 1) - 1
+			return factories[i%uint64(len(factories))]()
+		}, nil
+	}
+
+	if len(weights) != len(factories) {
+		return nil, errors.New("invalid factory weights settings")
+	}
+	total := 0
+	for _, weight := range weights {
+		if weight < 0 {
+			return nil, errors.New("invalid factory weights settings")
+		}
+		total += weight
+	}
+	if total == 0 {
+		return nil, errors.New("invalid factory weights settings")
+	}
+
+	return func(context.Context) (interface{}, error) {
+		n := rand.Intn(total)
+		for i, weight := range weights {
+			if n < weight {
+				return factories[i]()
+			}
+			n -= weight
+		}
+		return factories[len(factories)-1]()
+	}, nil
+}
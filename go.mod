@@ -1,3 +1,3 @@
 module github.com/kfrico/pool
 
-go 1.12
+go 1.20
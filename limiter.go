@@ -0,0 +1,71 @@
+package pool
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// createLimiter 令牌桶，限制創建連接的速率，桶中最多保留一個令牌，使創建均勻分佈
+type createLimiter struct {
+	mu sync.Mutex
+	// 產生一個令牌的間隔
+	interval time.Duration
+	// 下一個令牌可用的時間
+	next time.Time
+}
+
+// newCreateLimiter初始化每秒產生rate個令牌的令牌桶
+func newCreateLimiter(rate float64) *createLimiter {
+	return &createLimiter{interval: time.Duration(float64(time.Second) / rate)}
+}
+
+// allow有可用令牌時取走並返回true，不會等待
+func (l *createLimiter) allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Before(l.next) {
+		return false
+	}
+	l.next = now.Add(l.interval)
+	return true
+}
+
+// wait取走一個令牌，沒有可用令牌時等待，ctx取消或done關閉時歸還令牌並返回錯誤
+func (l *createLimiter) wait(ctx context.Context, done <-chan struct{}) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.cancel()
+		return ctx.Err()
+	case <-done:
+		l.cancel()
+		return ErrClosed
+	}
+}
+
+// cancel歸還一個未使用的令牌
+func (l *createLimiter) cancel() {
+	l.mu.Lock()
+	l.next = l.next.Add(-l.interval)
+	l.mu.Unlock()
+}
@@ -0,0 +1,82 @@
+package pool
+
+import "time"
+
+// Option 修改連接池配置的選項
+type Option func(*Config)
+
+// New使用選項初始化連接池，未設置的配置保持零值，其含義與Config相同
+func New(factory func() (interface{}, error), closeFun func(interface{}) error, opts ...Option) (Pool, error) {
+	poolConfig := &Config{
+		Factory: factory,
+		Close:   closeFun,
+	}
+	for _, opt := range opts {
+		opt(poolConfig)
+	}
+
+	return NewChannelPool(poolConfig)
+}
+
+// WithName設置連接池的名稱
+func WithName(name string) Option {
+	return func(c *Config) { c.Name = name }
+}
+
+// WithInitialCap設置初始連接數
+func WithInitialCap(n int) Option {
+	return func(c *Config) { c.InitialCap = n }
+}
+
+// WithMaxCap設置最大連接數
+func WithMaxCap(n int) Option {
+	return func(c *Config) { c.MaxCap = n }
+}
+
+// WithMinIdle設置保持的最少空閒連接數
+func WithMinIdle(n int) Option {
+	return func(c *Config) { c.MinIdle = n }
+}
+
+// WithMaxIdle設置最多保留的空閒連接數
+func WithMaxIdle(n int) Option {
+	return func(c *Config) { c.MaxIdle = n }
+}
+
+// WithPing設置檢查連接是否有效的方法
+func WithPing(ping func(interface{}) error) Option {
+	return func(c *Config) { c.Ping = ping }
+}
+
+// WithIdleTimeout設置連接的空閒超時時間
+func WithIdleTimeout(d time.Duration) Option {
+	return func(c *Config) { c.ConnMaxIdleTime = d }
+}
+
+// WithMaxConnLifetime設置連接的最長存活時間
+func WithMaxConnLifetime(d time.Duration) Option {
+	return func(c *Config) { c.ConnMaxLifetime = d }
+}
+
+// WithBlocking設置連接數達到上限時阻塞等待，最多等待timeout，0表示一直等待
+func WithBlocking(timeout time.Duration) Option {
+	return func(c *Config) {
+		c.Blocking = true
+		c.WaitTimeout = timeout
+	}
+}
+
+// WithReapInterval設置後台清理過期空閒連接的間隔
+func WithReapInterval(d time.Duration) Option {
+	return func(c *Config) { c.ReapInterval = d }
+}
+
+// WithLogger設置輸出診斷信息的日誌
+func WithLogger(logger Logger) Option {
+	return func(c *Config) { c.Logger = logger }
+}
+
+// WithLIFO設置以LIFO順序復用空閒連接
+func WithLIFO() Option {
+	return func(c *Config) { c.LIFO = true }
+}
@@ -1,21 +1,245 @@
 package pool
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	// ErrClosed連接池已經關閉Error
 	ErrClosed = errors.New("pool is closed")
+	// ErrMaxActiveConnReached連接數已達MaxCap上限Error
+	ErrMaxActiveConnReached = errors.New("max active connections reached")
+	// ErrTimeout等待連接超時Error
+	ErrTimeout = errors.New("timed out waiting for connection")
+	// ErrPoolFull連接池已滿，放回的連接已被關閉Error
+	ErrPoolFull = errors.New("pool is full, connection closed")
+	// ErrConnDiscarded放回的連接已被Reset、Evict或超過MaxConnLifetime，不再放回池中，已被關閉Error
+	ErrConnDiscarded = errors.New("connection discarded, connection closed")
+	// ErrConnReleased連接已經放回或關閉Error
+	ErrConnReleased = errors.New("connection already released")
+	// ErrTooManyWaiters等待連接的調用方已達MaxWaiters上限Error
+	ErrTooManyWaiters = errors.New("too many callers waiting for connection")
+	// ErrNilConnection factory返回了nil連接Error
+	ErrNilConnection = errors.New("factory returned a nil connection")
+	// ErrDegraded Get返回的連接未通過Ping檢查，只在設置AllowStale時返回，連接仍可使用，由調用方決定是否使用Error
+	ErrDegraded = errors.New("connection failed ping, returned degraded")
+	// ErrCloseTimeout關閉連接超過CloseTimeout，已不再等待Error
+	ErrCloseTimeout = errors.New("timed out closing connection")
+	// ErrCreateRateExceeded創建連接的速率已達MaxCreateRate上限Error
+	ErrCreateRateExceeded = errors.New("connection create rate exceeded")
+	// ErrUnhashableConn分片連接池無法記錄不能作為map key的連接所屬的分片Error
+	ErrUnhashableConn = errors.New("sharded pool requires hashable connections")
 )
 
+// FactoryError 調用Factory創建連接失敗
+type FactoryError struct {
+	Err error
+}
+
+func (e *FactoryError) Error() string { return e.Err.Error() }
+
+func (e *FactoryError) Unwrap() error { return e.Err }
+
+// PingError 連接未通過Ping檢查
+type PingError struct {
+	Err error
+}
+
+func (e *PingError) Error() string { return e.Err.Error() }
+
+func (e *PingError) Unwrap() error { return e.Err }
+
+// CloseError 調用Close關閉連接失敗
+type CloseError struct {
+	// 關閉失敗的連接
+	Conn interface{}
+	Err  error
+}
+
+func (e *CloseError) Error() string {
+	if e.Conn == nil {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("close connection %v: %s", e.Conn, e.Err)
+}
+
+func (e *CloseError) Unwrap() error { return e.Err }
+
 // Pool 基本方法
 type Pool interface {
 	Get() (interface{}, error)
 
+	GetContext(ctx context.Context) (interface{}, error)
+
+	GetWithTimeout(d time.Duration) (interface{}, error)
+
+	TryGet() (interface{}, bool, error)
+
+	GetMany(n int) ([]interface{}, error)
+
+	GetNContext(ctx context.Context, n int, partial bool) ([]interface{}, error)
+
+	GetAffinity(key interface{}) (interface{}, error)
+
 	Put(interface{}) error
 
+	PutAffinity(conn interface{}, key interface{}) error
+
+	PutAll(conns []interface{}) error
+
 	Close(interface{}) error
 
-	Release()
+	Release() error
+
+	ReleaseCount() (int, error)
+
+	Drain(ctx context.Context) error
+
+	WaitReady(ctx context.Context) error
+
+	Reset() error
+
+	Evict(pred func(interface{}) bool) (int, error)
+
+	SetFactory(factory func() (interface{}, error))
+
+	SetPing(ping func(interface{}) error)
+
+	SetClose(closeFun func(interface{}) error)
+
+	IsClosed() bool
+
+	HealthCheck() error
 
 	Len() int
+
+	IdleLen() int
+
+	Available() int
+
+	OldestIdle() (time.Duration, bool)
+
+	InspectIdle(fn func(conn interface{}, idleSince time.Time))
+
+	Meta(conn interface{}) (ConnMeta, bool)
+
+	Stats() Stats
+
+	Resize(newMaxCap int) error
+
+	Clone() (Pool, error)
+}
+
+// ConnMeta 連接池為每條連接記錄的信息
+type ConnMeta struct {
+	// 連接創建的時間
+	CreatedAt time.Time
+	// 最近一次放回池中或通過Ping檢查的時間
+	IdleSince time.Time
+	// 連接被取出的次數
+	Uses int
+	// FactoryWithMeta返回的標籤
+	Tags map[string]string
+}
+
+// EvictionPolicy 判斷空閒連接是否應被丟棄
+type EvictionPolicy interface {
+	ShouldEvict(conn interface{}, meta ConnMeta) bool
+}
+
+// EvictReason 連接被連接池關閉的原因
+type EvictReason int
+
+const (
+	// EvictIdleTimeout空閒時間超過IdleTimeout
+	EvictIdleTimeout EvictReason = iota
+	// EvictMaxLifetime存活時間超過MaxConnLifetime
+	EvictMaxLifetime
+	// EvictPingFailed未通過Ping檢查
+	EvictPingFailed
+	// EvictMaxUses使用次數達到MaxUses
+	EvictMaxUses
+	// EvictPoolFull放回時空閒連接已滿
+	EvictPoolFull
+	// EvictManual被Evict/Reset/Resize主動關閉
+	EvictManual
+	// EvictValidateFailed未通過Validate判斷
+	EvictValidateFailed
+	// EvictPolicy被EvictionPolicy判斷為應丟棄
+	EvictPolicy
+)
+
+// String返回原因的名稱
+func (r EvictReason) String() string {
+	switch r {
+	case EvictIdleTimeout:
+		return "idle_timeout"
+	case EvictMaxLifetime:
+		return "max_lifetime"
+	case EvictPingFailed:
+		return "ping_failed"
+	case EvictMaxUses:
+		return "max_uses"
+	case EvictPoolFull:
+		return "pool_full"
+	case EvictManual:
+		return "manual"
+	case EvictValidateFailed:
+		return "validate_failed"
+	case EvictPolicy:
+		return "policy"
+	default:
+		return fmt.Sprintf("EvictReason(%d)", int(r))
+	}
+}
+
+// Stats 連接池統計信息
+type Stats struct {
+	// 連接池的名稱
+	Name string
+	// 池中空閒的連接數
+	IdleCount int
+	// 已取出使用中的連接數
+	ActiveCount int
+	// 累計創建的連接數
+	TotalCreated int64
+	// 累計關閉的連接數
+	TotalClosed int64
+	// 累計等待連接的次數
+	WaitCount int64
+	// 累計等待連接的時間
+	WaitDuration time.Duration
+}
+
+// String輸出便於閱讀的統計信息
+func (s Stats) String() string {
+	str := fmt.Sprintf("idle=%d active=%d created=%d closed=%d waits=%d wait_duration=%s",
+		s.IdleCount, s.ActiveCount, s.TotalCreated, s.TotalClosed, s.WaitCount, s.WaitDuration)
+	if s.Name != "" {
+		str = "name=" + s.Name + " " + str
+	}
+	return str
+}
+
+// Logger 日誌輸出方法
+type Logger interface {
+	Printf(format string, args ...interface{})
+}
+
+// nopLogger 默認不輸出任何日誌
+type nopLogger struct{}
+
+func (nopLogger) Printf(format string, args ...interface{}) {}
+
+// namedLogger 在每條日誌前加上連接池的名稱
+type namedLogger struct {
+	name   string
+	logger Logger
+}
+
+func (l namedLogger) Printf(format string, args ...interface{}) {
+	l.logger.Printf("["+l.name+"] "+format, args...)
 }
@@ -0,0 +1,63 @@
+// Package poolprom 將連接池統計信息導出為Prometheus指標
+package poolprom
+
+import (
+	"github.com/kfrico/pool"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector 基於Pool.Stats()的prometheus.Collector
+type Collector struct {
+	p pool.Pool
+
+	idle         *prometheus.Desc
+	active       *prometheus.Desc
+	created      *prometheus.Desc
+	closed       *prometheus.Desc
+	waitCount    *prometheus.Desc
+	waitDuration *prometheus.Desc
+}
+
+// NewCollector創建連接池的Collector，namespace作為指標名稱的前綴
+// 連接池設置了Name時，指標帶有值為該名稱的pool標籤，同一namespace下可以註冊多個連接池
+func NewCollector(p pool.Pool, namespace string) *Collector {
+	var labels prometheus.Labels
+	if name := p.Stats().Name; name != "" {
+		labels = prometheus.Labels{"pool": name}
+	}
+	desc := func(name, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName(namespace, "pool", name), help, nil, labels)
+	}
+
+	return &Collector{
+		p:            p,
+		idle:         desc("idle_connections", "Number of idle connections in the pool."),
+		active:       desc("active_connections", "Number of connections checked out of the pool."),
+		created:      desc("created_total", "Total number of connections created by the pool."),
+		closed:       desc("closed_total", "Total number of connections closed by the pool."),
+		waitCount:    desc("wait_total", "Total number of times a caller waited for a connection."),
+		waitDuration: desc("wait_duration_seconds_total", "Total time callers spent waiting for a connection."),
+	}
+}
+
+// Describe實現prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.idle
+	ch <- c.active
+	ch <- c.created
+	ch <- c.closed
+	ch <- c.waitCount
+	ch <- c.waitDuration
+}
+
+// Collect實現prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	stats := c.p.Stats()
+
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stats.IdleCount))
+	ch <- prometheus.MustNewConstMetric(c.active, prometheus.GaugeValue, float64(stats.ActiveCount))
+	ch <- prometheus.MustNewConstMetric(c.created, prometheus.CounterValue, float64(stats.TotalCreated))
+	ch <- prometheus.MustNewConstMetric(c.closed, prometheus.CounterValue, float64(stats.TotalClosed))
+	ch <- prometheus.MustNewConstMetric(c.waitCount, prometheus.CounterValue, float64(stats.WaitCount))
+	ch <- prometheus.MustNewConstMetric(c.waitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds())
+}
@@ -0,0 +1,21 @@
+module github.com/kfrico/pool/poolprom
+
+go 1.20
+
+require (
+	github.com/kfrico/pool v0.0.0-20261014161215-ccf4bb56301a
+	github.com/prometheus/client_golang v1.19.1
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/prometheus/client_model v0.5.0 // indirect
+	github.com/prometheus/common v0.48.0 // indirect
+	github.com/prometheus/procfs v0.12.0 // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	google.golang.org/protobuf v1.33.0 // indirect
+)
+
+// 本地開發時使用上層目錄的連接池，發布的版本以require中的版本為準
+replace github.com/kfrico/pool => ../
@@ -0,0 +1,135 @@
+package pool
+
+// idleRing 空閒連接的環形隊列，從兩端取出時不移動其餘連接
+// 只在連接數超過曾經達到的最大容量時擴容，之後一直保留該容量，不會因取出或清空而重新分配
+type idleRing struct {
+	buf []*idleConn
+	// 第一條連接的位置
+	head int
+	// 連接數
+	n int
+}
+
+// newIdleRing初始化容量為size的環形隊列
+func newIdleRing(size int) idleRing {
+	return idleRing{buf: make([]*idleConn, size)}
+}
+
+// len隊列中的連接數
+func (r *idleRing) len() int {
+	return r.n
+}
+
+// at第i條連接，0為最早放入的連接
+func (r *idleRing) at(i int) *idleConn {
+	return r.buf[(r.head+i)%len(r.buf)]
+}
+
+// set替換第i條連接
+func (r *idleRing) set(i int, wrapConn *idleConn) {
+	r.buf[(r.head+i)%len(r.buf)] = wrapConn
+}
+
+// grow容量已滿時擴大一倍，並將連接按順序移到開頭
+func (r *idleRing) grow() {
+	if r.n < len(r.buf) {
+		return
+	}
+	size := 2 * len(r.buf)
+	if size == 0 {
+		size = 1
+	}
+	buf := make([]*idleConn, size)
+	for i := 0; i < r.n; i++ {
+		buf[i] = r.at(i)
+	}
+	r.buf, r.head = buf, 0
+}
+
+// pushBack在隊尾放入連接
+func (r *idleRing) pushBack(wrapConn *idleConn) {
+	r.grow()
+	r.n++
+	r.set(r.n-1, wrapConn)
+}
+
+// pushFront在隊首放入連接
+func (r *idleRing) pushFront(wrapConn *idleConn) {
+	r.grow()
+	r.head = (r.head + len(r.buf) - 1) % len(r.buf)
+	r.n++
+	r.set(0, wrapConn)
+}
+
+// popFront取出最早放入的連接，沒有時返回nil
+func (r *idleRing) popFront() *idleConn {
+	if r.n == 0 {
+		return nil
+	}
+	wrapConn := r.at(0)
+	r.set(0, nil)
+	r.head = (r.head + 1) % len(r.buf)
+	r.n--
+	return wrapConn
+}
+
+// popBack取出最近放入的連接，沒有時返回nil
+func (r *idleRing) popBack() *idleConn {
+	if r.n == 0 {
+		return nil
+	}
+	wrapConn := r.at(r.n - 1)
+	r.set(r.n-1, nil)
+	r.n--
+	return wrapConn
+}
+
+// removeAt移除第i條連接，保持其餘連接的順序
+func (r *idleRing) removeAt(i int) *idleConn {
+	wrapConn := r.at(i)
+	for ; i < r.n-1; i++ {
+		r.set(i, r.at(i+1))
+	}
+	r.set(r.n-1, nil)
+	r.n--
+	return wrapConn
+}
+
+// filter移除keep返回false的連接並按順序返回，保持其餘連接的順序
+func (r *idleRing) filter(keep func(*idleConn) bool) []*idleConn {
+	var removed []*idleConn
+	kept := 0
+	for i := 0; i < r.n; i++ {
+		wrapConn := r.at(i)
+		if keep(wrapConn) {
+			r.set(kept, wrapConn)
+			kept++
+		} else {
+			removed = append(removed, wrapConn)
+		}
+	}
+	for i := kept; i < r.n; i++ {
+		r.set(i, nil)
+	}
+	r.n = kept
+	return removed
+}
+
+// slice按順序複製所有連接
+func (r *idleRing) slice() []*idleConn {
+	conns := make([]*idleConn, r.n)
+	for i := range conns {
+		conns[i] = r.at(i)
+	}
+	return conns
+}
+
+// take按順序取出所有連接，隊列保留原有的容量
+func (r *idleRing) take() []*idleConn {
+	conns := r.slice()
+	for i := 0; i < r.n; i++ {
+		r.set(i, nil)
+	}
+	r.head, r.n = 0, 0
+	return conns
+}
@@ -0,0 +1,106 @@
+package pool
+
+import "testing"
+
+// ringConns返回按順序排列的連接
+func ringConns(r *idleRing) []interface{} {
+	conns := make([]interface{}, r.len())
+	for i := range conns {
+		conns[i] = r.at(i).conn
+	}
+	return conns
+}
+
+func equalConns(got []interface{}, want ...interface{}) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestIdleRingOrder(t *testing.T) {
+	r := newIdleRing(3)
+	for i := 0; i < 3; i++ {
+		r.pushBack(&idleConn{conn: i})
+	}
+	// 取出隊首後再放入，使隊列繞回緩衝區開頭
+	if got := r.popFront().conn; got != 0 {
+		t.Fatalf("popFront() = %v, want 0", got)
+	}
+	r.pushBack(&idleConn{conn: 3})
+	r.pushFront(&idleConn{conn: -1})
+	if got := ringConns(&r); !equalConns(got, -1, 1, 2, 3) {
+		t.Fatalf("conns = %v, want [-1 1 2 3]", got)
+	}
+	if got := r.removeAt(1).conn; got != 1 {
+		t.Fatalf("removeAt(1) = %v, want 1", got)
+	}
+	removed := r.filter(func(wrapConn *idleConn) bool { return wrapConn.conn != 2 })
+	if len(removed) != 1 || removed[0].conn != 2 {
+		t.Fatalf("filter() removed %v, want [2]", removed)
+	}
+	if got := r.popBack().conn; got != 3 {
+		t.Fatalf("popBack() = %v, want 3", got)
+	}
+	if got := ringConns(&r); !equalConns(got, -1) {
+		t.Fatalf("conns = %v, want [-1]", got)
+	}
+	taken := r.take()
+	if len(taken) != 1 || r.len() != 0 || r.popFront() != nil {
+		t.Fatalf("take() = %v, len %d, want one connection and an empty ring", taken, r.len())
+	}
+}
+
+func TestIdleStorageNotReallocated(t *testing.T) {
+	config := testConfig(4, 4)
+	config.Ping = func(interface{}) error { return nil }
+	p, err := NewChannelPool(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	c := p.(*channelPool)
+	buf := &c.conns.buf[0]
+	unchanged := func(step string) {
+		t.Helper()
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		if &c.conns.buf[0] != buf {
+			t.Fatalf("idle storage reallocated after %s", step)
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		conn, err := p.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Put(conn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	unchanged("Get/Put")
+	if err := p.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	unchanged("Reset")
+	if err := p.HealthCheck(); err != nil {
+		t.Fatal(err)
+	}
+	unchanged("HealthCheck")
+	if err := p.Resize(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Resize(4); err != nil {
+		t.Fatal(err)
+	}
+	unchanged("Resize")
+	if got := p.Len(); got != 2 {
+		t.Fatalf("Len() = %d, want 2", got)
+	}
+}
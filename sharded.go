@@ -0,0 +1,568 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shardedPool 將連接分散到多個channelPool，減少高併發時對單個鎖的競爭
+type shardedPool struct {
+	shards []Pool
+	// 輪詢選擇分片的計數
+	next uint64
+	// 取出的連接所屬的分片，放回時歸還到原分片
+	owners sync.Map
+	// 親和性key最近一次放回的分片
+	affinities sync.Map
+	// Get默認的超時時間
+	getTimeout time.Duration
+	// 阻塞模式下批量取連接的調用方逐個進行，避免各取得部分連接後互相等待
+	blocking bool
+	batch    chan struct{}
+}
+
+// NewShardedPool初始化分片連接池，shards為分片數，0表示默認為GOMAXPROCS
+// MaxCap/InitialCap/MinIdle/MaxIdle平均分配到各個分片，分片數不會超過MaxCap
+// 連接需能作為map的key以記錄所屬的分片，否則Get返回ErrUnhashableConn
+func NewShardedPool(poolConfig *Config, shards int) (Pool, error) {
+	if shards < 0 {
+		return nil, errors.New("invalid shard settings")
+	}
+	if shards == 0 {
+		shards = runtime.GOMAXPROCS(0)
+	}
+	if poolConfig.MaxCap > 0 && shards > poolConfig.MaxCap {
+		shards = poolConfig.MaxCap
+	}
+
+	s := newShardedPool(shards, poolConfig.GetTimeout, poolConfig.Blocking)
+	for i := 0; i < shards; i++ {
+		config := *poolConfig
+		config.MaxCap = splitCap(poolConfig.MaxCap, shards, i)
+		config.InitialCap = splitCap(poolConfig.InitialCap, shards, i)
+		config.MinIdle = splitCap(poolConfig.MinIdle, shards, i)
+		// MaxIdle為0表示不限制，分配後至少保留一個空閒連接
+		if config.MaxIdle = splitCap(poolConfig.MaxIdle, shards, i); poolConfig.MaxIdle > 0 && config.MaxIdle == 0 {
+			config.MaxIdle = 1
+		}
+
+		p, err := NewChannelPool(&config)
+		if err != nil {
+			s.Release()
+			return nil, err
+		}
+		s.shards = append(s.shards, p)
+	}
+
+	return s, nil
+}
+
+// newShardedPool初始化還沒有分片的連接池，NewShardedPool及Clone共用，使克隆的連接池保留相同的設置
+func newShardedPool(shards int, getTimeout time.Duration, blocking bool) *shardedPool {
+	return &shardedPool{
+		shards:     make([]Pool, 0, shards),
+		getTimeout: getTimeout,
+		blocking:   blocking,
+		batch:      make(chan struct{}, 1),
+	}
+}
+
+// splitCap將total平均分配到n個分片，返回第i個分片的份額
+func splitCap(total, n, i int) int {
+	share := total / n
+	if i < total%n {
+		share++
+	}
+	return share
+}
+
+// pick輪詢選擇下一個分片的序號
+func (s *shardedPool) pick() int {
+	return int(atomic.AddUint64(&s.next, 1) % uint64(len(s.shards)))
+}
+
+// own記錄連接所屬的分片
+// 不能作為map key的連接無法記錄分片，放回時會歸還到錯誤的分片而佔用原分片的名額，因此在原分片關閉並返回ErrUnhashableConn
+func (s *shardedPool) own(conn interface{}, shard Pool) error {
+	if !hashable(conn) {
+		shard.Close(conn)
+		return ErrUnhashableConn
+	}
+	s.owners.Store(conn, shard)
+	return nil
+}
+
+// owner取出連接所屬的分片，未記錄時輪詢選擇一個分片
+func (s *shardedPool) owner(conn interface{}) (Pool, error) {
+	if conn != nil && !hashable(conn) {
+		return nil, ErrUnhashableConn
+	}
+	if conn != nil {
+		if shard, ok := s.owners.LoadAndDelete(conn); ok {
+			return shard.(Pool), nil
+		}
+	}
+	return s.shards[s.pick()], nil
+}
+
+// Get從池中取一個連接，設置GetTimeout時最多等待GetTimeout
+func (s *shardedPool) Get() (interface{}, error) {
+	if s.getTimeout > 0 {
+		return s.GetWithTimeout(s.getTimeout)
+	}
+	return s.GetContext(context.Background())
+}
+
+// GetContext優先從有空閒連接的分片取，其次從還能創建連接的分片取，都沒有時在輪詢到的分片上等待
+func (s *shardedPool) GetContext(ctx context.Context) (interface{}, error) {
+	start := s.pick()
+	for i := range s.shards {
+		shard := s.shards[(start+i)%len(s.shards)]
+		conn, ok, err := shard.TryGet()
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			if err := s.own(conn, shard); err != nil {
+				return nil, err
+			}
+			return conn, nil
+		}
+	}
+
+	shard := s.shards[start]
+	for i := range s.shards {
+		if candidate := s.shards[(start+i)%len(s.shards)]; candidate.Available() > 0 {
+			shard = candidate
+			break
+		}
+	}
+
+	conn, err := shard.GetContext(ctx)
+	if conn == nil {
+		return nil, err
+	}
+	if ownErr := s.own(conn, shard); ownErr != nil {
+		return nil, ownErr
+	}
+	return conn, err
+}
+
+// GetWithTimeout從池中取一個連接，最多等待d，超時則返回ErrTimeout
+func (s *shardedPool) GetWithTimeout(d time.Duration) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+
+	conn, err := s.GetContext(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, ErrTimeout
+	}
+	return conn, err
+}
+
+// TryGet只從各分片的空閒連接中取一個可用連接，沒有時返回false
+func (s *shardedPool) TryGet() (interface{}, bool, error) {
+	start := s.pick()
+	for i := range s.shards {
+		shard := s.shards[(start+i)%len(s.shards)]
+		conn, ok, err := shard.TryGet()
+		if err != nil {
+			return nil, false, err
+		}
+		if ok {
+			if err := s.own(conn, shard); err != nil {
+				return nil, false, err
+			}
+			return conn, true, nil
+		}
+	}
+
+	return nil, false, nil
+}
+
+// GetMany一次取出n個連接，任一個失敗時放回已取出的連接並返回錯誤，阻塞模式下多個GetMany逐個進行
+func (s *shardedPool) GetMany(n int) ([]interface{}, error) {
+	if n <= 0 {
+		return nil, errors.New("invalid connection count")
+	}
+	// 釋放後各分片的Len及Available都為0，先判斷是否已關閉，返回ErrClosed而非ErrMaxActiveConnReached
+	if s.IsClosed() {
+		return nil, ErrClosed
+	}
+	if n > s.maxCap() {
+		return nil, ErrMaxActiveConnReached
+	}
+	if err := s.acquireBatch(context.Background()); err != nil {
+		return nil, err
+	}
+	defer s.releaseBatch()
+
+	conns := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := s.Get()
+		if err != nil {
+			// 未通過Ping的連接不放回池中
+			if conn != nil {
+				s.Close(conn)
+			}
+			s.PutAll(conns)
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	return conns, nil
+}
+
+// GetNContext從各分片取出n個連接，ctx取消或超時等錯誤發生時停止，partial為true時同時返回已取出的連接
+func (s *shardedPool) GetNContext(ctx context.Context, n int, partial bool) ([]interface{}, error) {
+	if n <= 0 {
+		return nil, errors.New("invalid connection count")
+	}
+	if s.IsClosed() {
+		return nil, ErrClosed
+	}
+	if n > s.maxCap() {
+		return nil, ErrMaxActiveConnReached
+	}
+	if err := s.acquireBatch(ctx); err != nil {
+		return nil, err
+	}
+	defer s.releaseBatch()
+
+	conns := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := s.GetContext(ctx)
+		if err != nil {
+			// 未通過Ping的連接不放回池中
+			if conn != nil {
+				s.Close(conn)
+			}
+			if partial {
+				return conns, err
+			}
+			s.PutAll(conns)
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+
+	return conns, nil
+}
+
+// acquireBatch阻塞模式下等待其他批量調用方完成
+func (s *shardedPool) acquireBatch(ctx context.Context) error {
+	if !s.blocking {
+		return nil
+	}
+	select {
+	case s.batch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseBatch結束本次批量取連接
+func (s *shardedPool) releaseBatch() {
+	if s.blocking {
+		<-s.batch
+	}
+}
+
+// GetAffinity從以相同key最近一次放回的分片取連接，沒有記錄時與Get相同
+func (s *shardedPool) GetAffinity(key interface{}) (interface{}, error) {
+	if key == nil || !hashable(key) {
+		return s.Get()
+	}
+	shard, ok := s.affinities.Load(key)
+	if !ok {
+		return s.Get()
+	}
+
+	conn, err := shard.(Pool).GetAffinity(key)
+	if conn == nil {
+		return nil, err
+	}
+	if ownErr := s.own(conn, shard.(Pool)); ownErr != nil {
+		return nil, ownErr
+	}
+	return conn, err
+}
+
+// maxCap各分片的最大連接數之和
+func (s *shardedPool) maxCap() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len() + shard.Available()
+	}
+	return n
+}
+
+// Put將連接放回其所屬的分片
+func (s *shardedPool) Put(conn interface{}) error {
+	shard, err := s.owner(conn)
+	if err != nil {
+		return err
+	}
+	return shard.Put(conn)
+}
+
+// PutAffinity將連接放回其所屬的分片，並記錄key對應的分片
+func (s *shardedPool) PutAffinity(conn interface{}, key interface{}) error {
+	shard, err := s.owner(conn)
+	if err != nil {
+		return err
+	}
+	if key != nil && hashable(key) {
+		s.affinities.Store(key, shard)
+	}
+	return shard.PutAffinity(conn, key)
+}
+
+// PutAll將多個連接放回其所屬的分片，返回所有失敗的錯誤合併後的錯誤
+func (s *shardedPool) PutAll(conns []interface{}) error {
+	var errs []error
+	for _, conn := range conns {
+		if err := s.Put(conn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Close關閉單條連接
+func (s *shardedPool) Close(conn interface{}) error {
+	shard, err := s.owner(conn)
+	if err != nil {
+		return err
+	}
+	return shard.Close(conn)
+}
+
+// Release釋放所有分片，返回所有關閉失敗的錯誤合併後的錯誤
+func (s *shardedPool) Release() error {
+	var errs []error
+	for _, shard := range s.shards {
+		if err := shard.Release(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ReleaseCount釋放所有分片，並返回成功關閉的連接總數
+func (s *shardedPool) ReleaseCount() (int, error) {
+	n := 0
+	var errs []error
+	for _, shard := range s.shards {
+		closed, err := shard.ReleaseCount()
+		n += closed
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return n, errors.Join(errs...)
+}
+
+// Drain同時等待所有分片的連接放回後釋放連接池
+func (s *shardedPool) Drain(ctx context.Context) error {
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func(i int, shard Pool) {
+			defer wg.Done()
+			errs[i] = shard.Drain(ctx)
+		}(i, shard)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// WaitReady依次等待每個分片預熱完成，返回第一個錯誤
+func (s *shardedPool) WaitReady(ctx context.Context) error {
+	for _, shard := range s.shards {
+		if err := shard.WaitReady(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Reset重建所有分片的連接，返回所有失敗的錯誤合併後的錯誤
+func (s *shardedPool) Reset() error {
+	var errs []error
+	for _, shard := range s.shards {
+		if err := shard.Reset(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Evict在所有分片中關閉滿足pred的空閒連接並返回關閉的總數，返回所有關閉失敗的錯誤合併後的錯誤
+func (s *shardedPool) Evict(pred func(interface{}) bool) (int, error) {
+	n := 0
+	var errs []error
+	for _, shard := range s.shards {
+		evicted, err := shard.Evict(pred)
+		n += evicted
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return n, errors.Join(errs...)
+}
+
+// SetFactory替換所有分片生成連接的方法
+func (s *shardedPool) SetFactory(factory func() (interface{}, error)) {
+	for _, shard := range s.shards {
+		shard.SetFactory(factory)
+	}
+}
+
+// SetPing替換所有分片檢查連接是否有效的方法
+func (s *shardedPool) SetPing(ping func(interface{}) error) {
+	for _, shard := range s.shards {
+		shard.SetPing(ping)
+	}
+}
+
+// SetClose替換所有分片關閉連接的方法
+func (s *shardedPool) SetClose(closeFun func(interface{}) error) {
+	for _, shard := range s.shards {
+		shard.SetClose(closeFun)
+	}
+}
+
+// IsClosed連接池是否已經釋放
+func (s *shardedPool) IsClosed() bool {
+	return s.shards[0].IsClosed()
+}
+
+// HealthCheck檢查所有分片，返回所有失敗的錯誤合併後的錯誤
+func (s *shardedPool) HealthCheck() error {
+	var errs []error
+	for _, shard := range s.shards {
+		if err := shard.HealthCheck(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Len所有分片擁有的連接總數(空閒+使用中)
+func (s *shardedPool) Len() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Len()
+	}
+	return n
+}
+
+// IdleLen所有分片中空閒的連接數
+func (s *shardedPool) IdleLen() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.IdleLen()
+	}
+	return n
+}
+
+// Available所有分片在達到上限之前還能創建的連接數
+func (s *shardedPool) Available() int {
+	n := 0
+	for _, shard := range s.shards {
+		n += shard.Available()
+	}
+	return n
+}
+
+// OldestIdle所有分片中最久未使用的空閒連接已空閒的時間，沒有空閒連接時返回false
+func (s *shardedPool) OldestIdle() (time.Duration, bool) {
+	var (
+		oldest time.Duration
+		found  bool
+	)
+	for _, shard := range s.shards {
+		if age, ok := shard.OldestIdle(); ok && (!found || age > oldest) {
+			oldest, found = age, true
+		}
+	}
+	return oldest, found
+}
+
+// InspectIdle依次對每個分片的空閒連接調用fn
+func (s *shardedPool) InspectIdle(fn func(conn interface{}, idleSince time.Time)) {
+	for _, shard := range s.shards {
+		shard.InspectIdle(fn)
+	}
+}
+
+// Meta在各分片中查找連接池記錄的連接信息
+func (s *shardedPool) Meta(conn interface{}) (ConnMeta, bool) {
+	for _, shard := range s.shards {
+		if meta, ok := shard.Meta(conn); ok {
+			return meta, true
+		}
+	}
+	return ConnMeta{}, false
+}
+
+// Stats所有分片的統計信息之和
+func (s *shardedPool) Stats() Stats {
+	var stats Stats
+	for _, shard := range s.shards {
+		shardStats := shard.Stats()
+		stats.Name = shardStats.Name
+		stats.IdleCount += shardStats.IdleCount
+		stats.ActiveCount += shardStats.ActiveCount
+		stats.TotalCreated += shardStats.TotalCreated
+		stats.TotalClosed += shardStats.TotalClosed
+		stats.WaitCount += shardStats.WaitCount
+		stats.WaitDuration += shardStats.WaitDuration
+	}
+	return stats
+}
+
+// Resize將新的最大連接數平均分配到各個分片
+func (s *shardedPool) Resize(newMaxCap int) error {
+	if newMaxCap < len(s.shards) {
+		return errors.New("invalid capacity settings")
+	}
+
+	var errs []error
+	for i, shard := range s.shards {
+		if err := shard.Resize(splitCap(newMaxCap, len(s.shards), i)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Clone克隆每個分片，創建分片數及配置都相同的新連接池
+func (s *shardedPool) Clone() (Pool, error) {
+	clone := newShardedPool(len(s.shards), s.getTimeout, s.blocking)
+	for _, shard := range s.shards {
+		p, err := shard.Clone()
+		if err != nil {
+			clone.Release()
+			return nil, err
+		}
+		clone.shards = append(clone.shards, p)
+	}
+
+	return clone, nil
+}
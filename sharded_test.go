@@ -0,0 +1,128 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestShardedRejectsUnhashable(t *testing.T) {
+	var mu sync.Mutex
+	closed := 0
+	config := testConfig(0, 4)
+	config.Factory = func() (interface{}, error) { return []byte("x"), nil }
+	config.Close = func(interface{}) error {
+		mu.Lock()
+		closed++
+		mu.Unlock()
+		return nil
+	}
+	p, err := NewShardedPool(config, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+
+	for i := 0; i < 8; i++ {
+		if _, err := p.Get(); !errors.Is(err, ErrUnhashableConn) {
+			t.Fatalf("Get() error = %v, want ErrUnhashableConn", err)
+		}
+	}
+	if err := p.Put([]byte("x")); !errors.Is(err, ErrUnhashableConn) {
+		t.Fatalf("Put() error = %v, want ErrUnhashableConn", err)
+	}
+	// 被拒絕的連接已在原分片關閉，不佔用名額
+	if got := p.Available(); got != 4 {
+		t.Fatalf("Available() = %d, want 4", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if closed != 8 {
+		t.Fatalf("closed %d connections, want 8", closed)
+	}
+}
+
+func BenchmarkShardedGetPut(b *testing.B) {
+	for _, bench := range []struct {
+		name   string
+		shards int
+	}{
+		{"single", 1},
+		{"sharded", 0},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			p, err := NewShardedPool(testConfig(64, 64), bench.shards)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer p.Release()
+
+			const goroutines = 64
+			var wg sync.WaitGroup
+			per := b.N/goroutines + 1
+			b.ResetTimer()
+			for g := 0; g < goroutines; g++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < per; i++ {
+						conn, err := p.Get()
+						if err != nil {
+							b.Error(err)
+							return
+						}
+						p.Put(conn)
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestShardedConcurrentGetManyBlocking(t *testing.T) {
+	config := testConfig(0, 4)
+	config.Blocking = true
+	p, err := NewShardedPool(config, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	concurrentGetMany(t, p)
+}
+
+func TestShardedCloneConcurrentGetManyBlocking(t *testing.T) {
+	config := testConfig(0, 4)
+	config.Blocking = true
+	p, err := NewShardedPool(config, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Release()
+	clone, err := p.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clone.Release()
+	// 克隆的連接池保留阻塞模式下批量取連接的設置
+	if c := clone.(*shardedPool); !c.blocking || c.batch == nil {
+		t.Fatal("Clone() dropped the blocking batch settings")
+	}
+	concurrentGetMany(t, clone)
+}
+
+func TestShardedGetManyAfterRelease(t *testing.T) {
+	p, err := NewShardedPool(testConfig(1, 2), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Release()
+
+	if _, err := p.GetMany(1); !errors.Is(err, ErrClosed) {
+		t.Fatalf("GetMany() after Release error = %v, want ErrClosed", err)
+	}
+	if _, err := p.GetNContext(context.Background(), 1, true); !errors.Is(err, ErrClosed) {
+		t.Fatalf("GetNContext() after Release error = %v, want ErrClosed", err)
+	}
+}
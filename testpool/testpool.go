@@ -0,0 +1,437 @@
+// Package testpool 提供實現pool.Pool的假連接池，用於測試依賴連接池的代碼，不會連接任何後端
+package testpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kfrico/pool"
+)
+
+// Calls 各方法被調用的次數
+type Calls struct {
+	Get     int
+	Put     int
+	Close   int
+	Release int
+}
+
+// idleConn 空閒連接及其放回的時間
+type idleConn struct {
+	conn interface{}
+	t    time.Time
+}
+
+// Pool 可編程的假連接池，連接數不超過capacity，默認的連接為從1開始遞增的int
+type Pool struct {
+	mu       sync.Mutex
+	capacity int
+	factory  func() (interface{}, error)
+	getErr   error
+	putErr   error
+	idle     []idleConn
+	// 已打開的連接數(空閒+使用中)
+	open   int
+	next   int
+	closed bool
+	// 累計統計
+	totalCreated int64
+	totalClosed  int64
+	calls        Calls
+}
+
+var _ pool.Pool = (*Pool)(nil)
+
+// New初始化最多capacity個連接的假連接池
+func New(capacity int) *Pool {
+	return &Pool{capacity: capacity}
+}
+
+// SetGetErr設置取連接時返回的錯誤，不為nil時不再取出連接，nil表示恢復正常
+func (p *Pool) SetGetErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.getErr = err
+}
+
+// SetPutErr設置放回連接時返回的錯誤，不為nil時放回的連接視為已關閉，nil表示恢復正常
+func (p *Pool) SetPutErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.putErr = err
+}
+
+// Calls返回各方法被調用的次數
+func (p *Pool) Calls() Calls {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.calls
+}
+
+// Get從池中取一個連接，沒有空閒連接時創建，連接數已達capacity時返回pool.ErrMaxActiveConnReached
+func (p *Pool) Get() (interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls.Get++
+	if p.closed {
+		return nil, pool.ErrClosed
+	}
+	if p.getErr != nil {
+		return nil, p.getErr
+	}
+	if n := len(p.idle); n > 0 {
+		conn := p.idle[n-1].conn
+		p.idle = p.idle[:n-1]
+		return conn, nil
+	}
+	if p.open >= p.capacity {
+		return nil, pool.ErrMaxActiveConnReached
+	}
+
+	var conn interface{}
+	if p.factory != nil {
+		var err error
+		if conn, err = p.factory(); err != nil {
+			return nil, &pool.FactoryError{Err: err}
+		}
+	} else {
+		p.next++
+		conn = p.next
+	}
+	p.open++
+	p.totalCreated++
+	return conn, nil
+}
+
+// GetContext與Get相同，ctx已取消時返回ctx.Err()
+func (p *Pool) GetContext(ctx context.Context) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return p.Get()
+}
+
+// GetWithTimeout與Get相同，不會等待
+func (p *Pool) GetWithTimeout(d time.Duration) (interface{}, error) {
+	return p.Get()
+}
+
+// TryGet只取空閒連接，沒有時返回false
+func (p *Pool) TryGet() (interface{}, bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls.Get++
+	if p.closed {
+		return nil, false, pool.ErrClosed
+	}
+	if p.getErr != nil {
+		return nil, false, p.getErr
+	}
+	n := len(p.idle)
+	if n == 0 {
+		return nil, false, nil
+	}
+	conn := p.idle[n-1].conn
+	p.idle = p.idle[:n-1]
+	return conn, true, nil
+}
+
+// GetMany一次取出n個連接，任一個失敗時放回已取出的連接並返回錯誤
+func (p *Pool) GetMany(n int) ([]interface{}, error) {
+	if n <= 0 {
+		return nil, errors.New("invalid connection count")
+	}
+
+	conns := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := p.Get()
+		if err != nil {
+			p.PutAll(conns)
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// GetNContext取出n個連接，失敗時partial為true則返回已取出的連接及錯誤，否則放回已取出的連接
+func (p *Pool) GetNContext(ctx context.Context, n int, partial bool) ([]interface{}, error) {
+	if n <= 0 {
+		return nil, errors.New("invalid connection count")
+	}
+
+	conns := make([]interface{}, 0, n)
+	for i := 0; i < n; i++ {
+		conn, err := p.GetContext(ctx)
+		if err != nil {
+			if partial {
+				return conns, err
+			}
+			p.PutAll(conns)
+			return nil, err
+		}
+		conns = append(conns, conn)
+	}
+	return conns, nil
+}
+
+// GetAffinity與Get相同，忽略key
+func (p *Pool) GetAffinity(key interface{}) (interface{}, error) {
+	return p.Get()
+}
+
+// Put將連接放回池中，設置了SetPutErr時返回該錯誤並視為關閉該連接
+func (p *Pool) Put(conn interface{}) error {
+	if conn == nil {
+		return errors.New("connection is nil. rejecting")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls.Put++
+	if p.closed {
+		p.forget()
+		return pool.ErrClosed
+	}
+	if p.putErr != nil {
+		p.forget()
+		return p.putErr
+	}
+	p.idle = append(p.idle, idleConn{conn: conn, t: time.Now()})
+	return nil
+}
+
+// PutAffinity與Put相同，忽略key
+func (p *Pool) PutAffinity(conn interface{}, key interface{}) error {
+	return p.Put(conn)
+}
+
+// PutAll將多個連接放回池中，返回所有失敗的錯誤合併後的錯誤
+func (p *Pool) PutAll(conns []interface{}) error {
+	var errs []error
+	for _, conn := range conns {
+		if err := p.Put(conn); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close關閉單條使用中的連接
+func (p *Pool) Close(conn interface{}) error {
+	if conn == nil {
+		return errors.New("connection is nil. rejecting")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls.Close++
+	p.forget()
+	return nil
+}
+
+// forget減少已打開的連接數，需持有mu
+func (p *Pool) forget() {
+	if p.open > 0 {
+		p.open--
+	}
+	p.totalClosed++
+}
+
+// Release釋放連接池，關閉所有空閒連接
+func (p *Pool) Release() error {
+	_, err := p.ReleaseCount()
+	return err
+}
+
+// ReleaseCount釋放連接池，並返回關閉的空閒連接數
+func (p *Pool) ReleaseCount() (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls.Release++
+	if p.closed {
+		return 0, nil
+	}
+	p.closed = true
+	n := len(p.idle)
+	for range p.idle {
+		p.forget()
+	}
+	p.idle = nil
+	return n, nil
+}
+
+// Drain直接釋放連接池，不等待使用中的連接
+func (p *Pool) Drain(ctx context.Context) error {
+	return p.Release()
+}
+
+// WaitReady連接池未釋放時直接返回nil
+func (p *Pool) WaitReady(ctx context.Context) error {
+	if p.IsClosed() {
+		return pool.ErrClosed
+	}
+	return nil
+}
+
+// Reset關閉所有空閒連接
+func (p *Pool) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return pool.ErrClosed
+	}
+	for range p.idle {
+		p.forget()
+	}
+	p.idle = nil
+	return nil
+}
+
+// Evict關閉滿足pred的空閒連接並返回關閉的數量
+func (p *Pool) Evict(pred func(interface{}) bool) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	keep := p.idle[:0]
+	n := 0
+	for _, idle := range p.idle {
+		if pred(idle.conn) {
+			p.forget()
+			n++
+		} else {
+			keep = append(keep, idle)
+		}
+	}
+	p.idle = keep
+	return n, nil
+}
+
+// SetFactory設置生成連接的方法，返回的錯誤由Get包裝為pool.FactoryError返回
+func (p *Pool) SetFactory(factory func() (interface{}, error)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.factory = factory
+}
+
+// SetPing不做任何處理
+func (p *Pool) SetPing(ping func(interface{}) error) {}
+
+// SetClose不做任何處理
+func (p *Pool) SetClose(closeFun func(interface{}) error) {}
+
+// IsClosed連接池是否已經釋放
+func (p *Pool) IsClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+// HealthCheck連接池已釋放時返回pool.ErrClosed
+func (p *Pool) HealthCheck() error {
+	if p.IsClosed() {
+		return pool.ErrClosed
+	}
+	return nil
+}
+
+// Len連接池擁有的連接總數(空閒+使用中)
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.open
+}
+
+// IdleLen空閒的連接數
+func (p *Pool) IdleLen() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.idle)
+}
+
+// Available在達到capacity之前還能創建的連接數
+func (p *Pool) Available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || p.open >= p.capacity {
+		return 0
+	}
+	return p.capacity - p.open
+}
+
+// OldestIdle最久未使用的空閒連接已空閒的時間，沒有空閒連接時返回false
+func (p *Pool) OldestIdle() (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle) == 0 {
+		return 0, false
+	}
+	return time.Since(p.idle[0].t), true
+}
+
+// InspectIdle對每條空閒連接調用fn
+func (p *Pool) InspectIdle(fn func(conn interface{}, idleSince time.Time)) {
+	p.mu.Lock()
+	idle := append([]idleConn(nil), p.idle...)
+	p.mu.Unlock()
+
+	for _, wrapConn := range idle {
+		fn(wrapConn.conn, wrapConn.t)
+	}
+}
+
+// Meta不記錄連接信息，總是返回false
+func (p *Pool) Meta(conn interface{}) (pool.ConnMeta, bool) {
+	return pool.ConnMeta{}, false
+}
+
+// Stats連接池統計信息
+func (p *Pool) Stats() pool.Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return pool.Stats{
+		IdleCount:    len(p.idle),
+		ActiveCount:  p.open - len(p.idle),
+		TotalCreated: p.totalCreated,
+		TotalClosed:  p.totalClosed,
+	}
+}
+
+// Resize調整最多的連接數
+func (p *Pool) Resize(newMaxCap int) error {
+	if newMaxCap <= 0 {
+		return errors.New("invalid capacity settings")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.capacity = newMaxCap
+	return nil
+}
+
+// Clone創建capacity、factory及錯誤設置都相同的新假連接池
+func (p *Pool) Clone() (pool.Pool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return &Pool{capacity: p.capacity, factory: p.factory, getErr: p.getErr, putErr: p.putErr}, nil
+}
@@ -0,0 +1,398 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// TypedConfig 泛型連接池配置，Factory/Close/Ping使用具體類型
+type TypedConfig[T any] struct {
+	// 通用配置，其中的Factory/FactoryWithMeta/FactoryContext/Close/Ping/PingContext/Validate/Prepare會被忽略
+	Config
+	// 生成連接的方法
+	Factory func() (T, error)
+	// 生成連接並返回連接標籤的方法，設置後優先於Factory
+	FactoryWithMeta func() (T, map[string]string, error)
+	// 支持context的生成連接的方法，設置後優先於Factory
+	FactoryContext func(ctx context.Context) (T, error)
+	// 關閉連接的方法
+	Close func(T) error
+	// 檢查連接是否有效的方法
+	Ping func(T) error
+	// 支持context的檢查連接的方法，設置後優先於Ping
+	PingContext func(ctx context.Context, conn T) error
+	// 自定義的連接可用性判斷，返回false則關閉該連接
+	Validate func(T) bool
+	// 新創建的連接在放入連接池前調用，返回錯誤時關閉該連接並視為創建失敗
+	Prepare func(T) error
+}
+
+// TypedPool 泛型連接池基本方法，免去對interface{}的類型斷言
+type TypedPool[T any] interface {
+	Get() (T, error)
+
+	GetContext(ctx context.Context) (T, error)
+
+	GetWithTimeout(d time.Duration) (T, error)
+
+	TryGet() (T, bool, error)
+
+	GetMany(n int) ([]T, error)
+
+	GetNContext(ctx context.Context, n int, partial bool) ([]T, error)
+
+	GetAffinity(key interface{}) (T, error)
+
+	Put(T) error
+
+	PutAffinity(conn T, key interface{}) error
+
+	PutAll(conns []T) error
+
+	Close(T) error
+
+	Release() error
+
+	ReleaseCount() (int, error)
+
+	Drain(ctx context.Context) error
+
+	WaitReady(ctx context.Context) error
+
+	Reset() error
+
+	Evict(pred func(T) bool) (int, error)
+
+	SetFactory(factory func() (T, error))
+
+	SetPing(ping func(T) error)
+
+	SetClose(closeFun func(T) error)
+
+	IsClosed() bool
+
+	HealthCheck() error
+
+	Len() int
+
+	IdleLen() int
+
+	Available() int
+
+	OldestIdle() (time.Duration, bool)
+
+	InspectIdle(fn func(conn T, idleSince time.Time))
+
+	Meta(conn T) (ConnMeta, bool)
+
+	Stats() Stats
+
+	Resize(newMaxCap int) error
+
+	Clone() (TypedPool[T], error)
+}
+
+// typedPool 基於Pool的泛型包裝
+type typedPool[T any] struct {
+	p Pool
+}
+
+// NewTypedPool初始化泛型連接池
+func NewTypedPool[T any](poolConfig *TypedConfig[T]) (TypedPool[T], error) {
+	config := poolConfig.Config
+	config.Factory = nil
+	config.FactoryWithMeta = nil
+	config.FactoryContext = nil
+	config.Close = nil
+	config.Ping = nil
+	config.PingContext = nil
+	config.Validate = nil
+	config.Prepare = nil
+
+	if factory := poolConfig.Factory; factory != nil {
+		config.Factory = func() (interface{}, error) {
+			return factory()
+		}
+	}
+
+	if factory := poolConfig.FactoryWithMeta; factory != nil {
+		config.FactoryWithMeta = func() (interface{}, map[string]string, error) {
+			return factory()
+		}
+	}
+
+	if factory := poolConfig.FactoryContext; factory != nil {
+		config.FactoryContext = func(ctx context.Context) (interface{}, error) {
+			return factory(ctx)
+		}
+	}
+
+	if closeFun := poolConfig.Close; closeFun != nil {
+		config.Close = func(conn interface{}) error {
+			return closeFun(conn.(T))
+		}
+	}
+
+	if ping := poolConfig.Ping; ping != nil {
+		config.Ping = func(conn interface{}) error {
+			return ping(conn.(T))
+		}
+	}
+
+	if ping := poolConfig.PingContext; ping != nil {
+		config.PingContext = func(ctx context.Context, conn interface{}) error {
+			return ping(ctx, conn.(T))
+		}
+	}
+
+	if validate := poolConfig.Validate; validate != nil {
+		config.Validate = func(conn interface{}) bool {
+			return validate(conn.(T))
+		}
+	}
+
+	if prepare := poolConfig.Prepare; prepare != nil {
+		config.Prepare = func(conn interface{}) error {
+			return prepare(conn.(T))
+		}
+	}
+
+	p, err := NewChannelPool(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &typedPool[T]{p: p}, nil
+}
+
+// Get從池中取一個連接
+func (t *typedPool[T]) Get() (T, error) {
+	conn, err := t.p.Get()
+	if conn == nil {
+		var zero T
+		return zero, err
+	}
+
+	return conn.(T), err
+}
+
+// GetContext從池中取一個連接，ctx取消或超時則返回ctx.Err()
+func (t *typedPool[T]) GetContext(ctx context.Context) (T, error) {
+	conn, err := t.p.GetContext(ctx)
+	if conn == nil {
+		var zero T
+		return zero, err
+	}
+
+	return conn.(T), err
+}
+
+// GetWithTimeout從池中取一個連接，最多等待d，超時則返回ErrTimeout
+func (t *typedPool[T]) GetWithTimeout(d time.Duration) (T, error) {
+	conn, err := t.p.GetWithTimeout(d)
+	if conn == nil {
+		var zero T
+		return zero, err
+	}
+
+	return conn.(T), err
+}
+
+// TryGet只從空閒連接中取一個可用連接，沒有時返回false
+func (t *typedPool[T]) TryGet() (T, bool, error) {
+	conn, ok, err := t.p.TryGet()
+	if !ok {
+		var zero T
+		return zero, ok, err
+	}
+
+	return conn.(T), ok, err
+}
+
+// GetMany一次取出n個連接，任一個失敗時放回已取出的連接
+func (t *typedPool[T]) GetMany(n int) ([]T, error) {
+	conns, err := t.p.GetMany(n)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := make([]T, len(conns))
+	for i, conn := range conns {
+		typed[i] = conn.(T)
+	}
+	return typed, nil
+}
+
+// GetNContext取出n個連接，ctx取消或超時則停止，partial為true時同時返回已取出的連接
+func (t *typedPool[T]) GetNContext(ctx context.Context, n int, partial bool) ([]T, error) {
+	conns, err := t.p.GetNContext(ctx, n, partial)
+	if conns == nil {
+		return nil, err
+	}
+
+	typed := make([]T, len(conns))
+	for i, conn := range conns {
+		typed[i] = conn.(T)
+	}
+	return typed, err
+}
+
+// GetAffinity優先取回以相同key放回的連接
+func (t *typedPool[T]) GetAffinity(key interface{}) (T, error) {
+	conn, err := t.p.GetAffinity(key)
+	if conn == nil {
+		var zero T
+		return zero, err
+	}
+
+	return conn.(T), err
+}
+
+// Put將連接放回pool中
+func (t *typedPool[T]) Put(conn T) error {
+	return t.p.Put(conn)
+}
+
+// PutAffinity將連接放回pool中並記錄親和性key
+func (t *typedPool[T]) PutAffinity(conn T, key interface{}) error {
+	return t.p.PutAffinity(conn, key)
+}
+
+// PutAll將多個連接放回pool中
+func (t *typedPool[T]) PutAll(conns []T) error {
+	untyped := make([]interface{}, len(conns))
+	for i, conn := range conns {
+		untyped[i] = conn
+	}
+	return t.p.PutAll(untyped)
+}
+
+// Close關閉單條連接
+func (t *typedPool[T]) Close(conn T) error {
+	return t.p.Close(conn)
+}
+
+// Release釋放連接池中所有連接
+func (t *typedPool[T]) Release() error {
+	return t.p.Release()
+}
+
+// ReleaseCount釋放連接池中所有連接，並返回成功關閉的連接數
+func (t *typedPool[T]) ReleaseCount() (int, error) {
+	return t.p.ReleaseCount()
+}
+
+// Drain等待所有使用中的連接放回後釋放連接池
+func (t *typedPool[T]) Drain(ctx context.Context) error {
+	return t.p.Drain(ctx)
+}
+
+// WaitReady等待連接池預熱完成
+func (t *typedPool[T]) WaitReady(ctx context.Context) error {
+	return t.p.WaitReady(ctx)
+}
+
+// Reset關閉所有空閒連接並重新創建InitialCap個連接
+func (t *typedPool[T]) Reset() error {
+	return t.p.Reset()
+}
+
+// Evict關閉滿足pred的空閒連接並返回關閉的數量，滿足pred的使用中連接在放回時關閉
+func (t *typedPool[T]) Evict(pred func(T) bool) (int, error) {
+	return t.p.Evict(func(conn interface{}) bool {
+		return pred(conn.(T))
+	})
+}
+
+// SetFactory替換生成連接的方法
+func (t *typedPool[T]) SetFactory(factory func() (T, error)) {
+	if factory == nil {
+		return
+	}
+	t.p.SetFactory(func() (interface{}, error) {
+		return factory()
+	})
+}
+
+// SetPing替換檢查連接是否有效的方法，傳入nil表示不再檢查
+func (t *typedPool[T]) SetPing(ping func(T) error) {
+	if ping == nil {
+		t.p.SetPing(nil)
+		return
+	}
+	t.p.SetPing(func(conn interface{}) error {
+		return ping(conn.(T))
+	})
+}
+
+// SetClose替換關閉連接的方法
+func (t *typedPool[T]) SetClose(closeFun func(T) error) {
+	if closeFun == nil {
+		return
+	}
+	t.p.SetClose(func(conn interface{}) error {
+		return closeFun(conn.(T))
+	})
+}
+
+// IsClosed連接池是否已經釋放
+func (t *typedPool[T]) IsClosed() bool {
+	return t.p.IsClosed()
+}
+
+// HealthCheck檢查所有空閒連接並確認連接池可用
+func (t *typedPool[T]) HealthCheck() error {
+	return t.p.HealthCheck()
+}
+
+// Len連接池擁有的連接總數(空閒+使用中)
+func (t *typedPool[T]) Len() int {
+	return t.p.Len()
+}
+
+// IdleLen連接池中空閒的連接數
+func (t *typedPool[T]) IdleLen() int {
+	return t.p.IdleLen()
+}
+
+// Available在達到MaxCap之前還能創建的連接數
+func (t *typedPool[T]) Available() int {
+	return t.p.Available()
+}
+
+// OldestIdle最久未使用的空閒連接已空閒的時間，沒有空閒連接時返回false
+func (t *typedPool[T]) OldestIdle() (time.Duration, bool) {
+	return t.p.OldestIdle()
+}
+
+// InspectIdle按順序對每條空閒連接調用fn，連接仍留在池中，fn不能保留或使用該連接
+func (t *typedPool[T]) InspectIdle(fn func(conn T, idleSince time.Time)) {
+	t.p.InspectIdle(func(conn interface{}, idleSince time.Time) {
+		fn(conn.(T), idleSince)
+	})
+}
+
+// Meta取得連接池記錄的連接信息
+func (t *typedPool[T]) Meta(conn T) (ConnMeta, bool) {
+	return t.p.Meta(conn)
+}
+
+// Stats連接池統計信息
+func (t *typedPool[T]) Stats() Stats {
+	return t.p.Stats()
+}
+
+// Resize運行時調整連接池的最大連接數
+func (t *typedPool[T]) Resize(newMaxCap int) error {
+	return t.p.Resize(newMaxCap)
+}
+
+// Clone使用相同的配置創建一個新的泛型連接池
+func (t *typedPool[T]) Clone() (TypedPool[T], error) {
+	p, err := t.p.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return &typedPool[T]{p: p}, nil
+}